@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/gin-gonic/gin"
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/auth"
 	"github.com/limosnd/marketplace-go-graphql/internal/database"
 	"github.com/limosnd/marketplace-go-graphql/internal/generated"
+	"github.com/limosnd/marketplace-go-graphql/internal/jobs"
+	"github.com/limosnd/marketplace-go-graphql/internal/loaders"
 	"github.com/limosnd/marketplace-go-graphql/internal/resolvers"
+	"github.com/limosnd/marketplace-go-graphql/internal/services"
+	"github.com/limosnd/marketplace-go-graphql/internal/storage"
 )
 
 func main() {
@@ -21,9 +29,137 @@ func main() {
 	}
 	defer database.Disconnect()
 
+	// Configurar JWT
+	tokens, err := auth.NewTokenManagerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+
+	// Configurar almacenamiento de imagenes
+	store, err := storage.NewBlobStoreFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+
+	// Configurar vigencia de los anuncios
+	lifetime, err := jobs.DaysFromEnv("LISTING_LIFETIME_DAYS", int(services.DefaultListingLifetime.Hours()/24))
+	if err != nil {
+		log.Fatalf("Failed to configure listing lifetime: %v", err)
+	}
+
+	// Configurar cuenta de administrador
+	adminEmail, adminPassword, err := services.AdminFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure admin account: %v", err)
+	}
+
 	// Configurar GraphQL
-	resolver := resolvers.NewResolver(db)
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
+	resolver := resolvers.NewResolver(db, tokens, store)
+	resolver.CarService.ListingLifetime = lifetime
+	resolver.UserService.AdminEmail = adminEmail
+	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
+		Resolvers: resolver,
+		Directives: generated.DirectiveRoot{
+			Auth:    auth.AuthDirective,
+			HasRole: auth.HasRoleDirective,
+		},
+	}))
+	srv.SetErrorPresenter(apperrors.Presenter)
+
+	// Crear la cuenta de administrador de ADMIN_EMAIL
+	migrateCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	created, err := resolver.UserService.CreateAdmin(migrateCtx, adminPassword)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to create admin account: %v", err)
+	} else if created {
+		log.Printf("Created admin account %s", adminEmail)
+	}
+
+	// Migrar vendedores embebidos a referencias de usuario
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	migrated, err := resolver.CarService.MigrateEmbeddedSellers(migrateCtx, resolver.UserService)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate car sellers: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated sellers of %d cars", migrated)
+	}
+
+	// Agregar puntos GeoJSON a las ubicaciones con coordenadas
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	migrated, err = resolver.CarService.MigrateLocationPoints(migrateCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate car locations: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated locations of %d cars", migrated)
+	}
+
+	// Dar vigencia a los anuncios publicados antes de la expiracion
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	migrated, err = resolver.CarService.MigrateListingExpiry(migrateCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate listing expiry: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Set expiry of %d cars", migrated)
+	}
+
+	// Liberar los VIN de anuncios que ya no estan publicados
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	migrated, err = resolver.CarService.MigrateActiveVINs(migrateCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate active VINs: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Released VINs of %d cars", migrated)
+	}
+
+	// Generar claves de busqueda en minusculas para los filtros de texto
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	migrated, err = resolver.CarService.MigrateSearchKeys(migrateCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate search keys: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Added search keys to %d cars", migrated)
+	}
+
+	// Cargar el catalogo de marcas y modelos, y normalizar los anuncios existentes
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	seeded, err := resolver.CatalogService.SeedCatalog(migrateCtx)
+	migrated = 0
+	if err == nil && seeded > 0 {
+		// Los anuncios se normalizan al guardarse, los existentes solo si cambia el catalogo
+		migrated, err = resolver.CarService.MigrateCatalogNames(migrateCtx)
+	}
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to load car catalog: %v", err)
+	} else if seeded > 0 || migrated > 0 {
+		log.Printf("Seeded %d catalog brands and normalized %d cars", seeded, migrated)
+	}
+
+	// Convertir las URLs de imagenes en imagenes con variantes
+	migrateCtx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	migrated, err = resolver.CarService.MigrateImages(migrateCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: Failed to migrate car images: %v", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated images of %d cars", migrated)
+	}
+
+	// Tareas periodicas
+	retention, err := jobs.DaysFromEnv("CAR_RETENTION_DAYS", 30)
+	if err != nil {
+		log.Fatalf("Failed to configure jobs: %v", err)
+	}
+	jobs.NewRunner(
+		jobs.PurgeDeletedCars(resolver.CarService, retention),
+		jobs.ExpireCars(resolver.CarService),
+	).Start(context.Background())
 
 	// Configurar Gin
 	r := gin.Default()
@@ -32,7 +168,7 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, "+auth.GuestCartHeader)
 		if c.Request.Method == "OPTIONS" {
 			c.Status(200)
 			return
@@ -41,9 +177,12 @@ func main() {
 	})
 
 	// GraphQL endpoints
-	r.POST("/query", gin.WrapH(srv))
+	r.POST("/query", auth.Middleware(tokens, resolver.UserService), gin.WrapH(loaders.Middleware(resolver.CarService, resolver.UserService, srv)))
 	r.GET("/playground", gin.WrapH(playground.Handler("GraphQL playground", "/query")))
 
+	// Imagenes subidas
+	r.GET(services.ImagePathPrefix+"*key", storage.Handler(store))
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -0,0 +1,94 @@
+package apperrors
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes exposed to clients in the "code" extension of GraphQL errors
+const (
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeBadUserInput    = "BAD_USER_INPUT"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+)
+
+// FieldError describes why a single input field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error that carries a client facing error code
+type Error struct {
+	Code    string
+	Message string
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unauthenticated returns an error for requests without valid credentials
+func Unauthenticated(message string) *Error {
+	return &Error{Code: CodeUnauthenticated, Message: message}
+}
+
+// Forbidden returns an error for authenticated users lacking permission
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+// BadUserInput returns an error for invalid arguments sent by the client
+func BadUserInput(message string) *Error {
+	return &Error{Code: CodeBadUserInput, Message: message}
+}
+
+// InvalidFields returns a BAD_USER_INPUT error listing every invalid field
+func InvalidFields(message string, fields []FieldError) *Error {
+	details := make([]string, len(fields))
+	for i, field := range fields {
+		details[i] = field.Field + ": " + field.Message
+	}
+
+	return &Error{
+		Code:    CodeBadUserInput,
+		Message: message + " (" + strings.Join(details, "; ") + ")",
+		Fields:  fields,
+	}
+}
+
+// NotFound returns an error for resources that do not exist
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Message: message}
+}
+
+// Conflict returns an error for changes that clash with the current state of a resource
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+// Presenter converts application errors into GraphQL errors with a code extension
+func Presenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		gqlErr.Message = appErr.Message
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = map[string]interface{}{}
+		}
+		gqlErr.Extensions["code"] = appErr.Code
+		if len(appErr.Fields) > 0 {
+			gqlErr.Extensions["fields"] = appErr.Fields
+		}
+	}
+
+	return gqlErr
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// ErrForbidden is returned when the caller's role is not allowed to run an operation
+var ErrForbidden = apperrors.Forbidden("you are not allowed to perform this operation")
+
+// AuthDirective implements @auth, which requires an authenticated user
+func AuthDirective(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	if _, err := RequireUser(ctx); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// HasRoleDirective implements @hasRole, which requires the user to have one of the given roles
+func HasRoleDirective(ctx context.Context, obj interface{}, next graphql.Resolver, roles []models.UserRole) (interface{}, error) {
+	user, err := RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		if user.Role == role {
+			return next(ctx)
+		}
+	}
+
+	return nil, ErrForbidden
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+	"github.com/limosnd/marketplace-go-graphql/internal/services"
+)
+
+type contextKey struct{ name string }
+
+var (
+	userContextKey       = &contextKey{"user"}
+	guestTokenContextKey = &contextKey{"guestToken"}
+)
+
+// GuestCartHeader is the request header carrying the token of a guest cart
+const GuestCartHeader = "X-Cart-Token"
+
+// ErrUnauthenticated is returned when an operation requires a signed in user
+var ErrUnauthenticated = apperrors.Unauthenticated("authentication required")
+
+// Middleware resolves the user behind the "Authorization: Bearer" header and
+// stores it in the request context. Requests without the header continue
+// anonymously, requests with an invalid token are rejected.
+func Middleware(tokens *TokenManager, users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if guestToken := c.GetHeader(GuestCartHeader); guestToken != "" {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), guestTokenContextKey, guestToken))
+		}
+
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		tokenString, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenString == "" {
+			abortUnauthenticated(c, ErrInvalidToken)
+			return
+		}
+
+		claims, err := tokens.ValidateToken(tokenString)
+		if err != nil {
+			abortUnauthenticated(c, err)
+			return
+		}
+
+		user, err := users.GetUserByID(c.Request.Context(), claims.Subject)
+		if err != nil {
+			abortUnauthenticated(c, ErrInvalidToken)
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithUser(c.Request.Context(), user))
+		c.Next()
+	}
+}
+
+// abortUnauthenticated answers with a GraphQL shaped error body
+func abortUnauthenticated(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"errors": []gin.H{{
+			"message":    err.Error(),
+			"extensions": gin.H{"code": apperrors.CodeUnauthenticated},
+		}},
+	})
+}
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the authenticated user, or nil for anonymous requests
+func UserFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userContextKey).(*models.User)
+	return user
+}
+
+// GuestTokenFromContext returns the guest cart token sent with the request, if any
+func GuestTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(guestTokenContextKey).(string)
+	return token
+}
+
+// RequireUser returns the authenticated user or an UNAUTHENTICATED error
+func RequireUser(ctx context.Context) (*models.User, error) {
+	user := UserFromContext(ctx)
+	if user == nil {
+		return nil, ErrUnauthenticated
+	}
+	return user, nil
+}
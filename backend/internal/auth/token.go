@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+const (
+	defaultTokenExpiry = 24 * time.Hour
+	defaultIssuer      = "marketplace"
+)
+
+// ErrInvalidToken is returned when a token cannot be verified
+var ErrInvalidToken = apperrors.Unauthenticated("invalid or expired token")
+
+// Claims are the JWT claims issued to authenticated users
+type Claims struct {
+	Role models.UserRole `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager signs and verifies access tokens
+type TokenManager struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	expiry    time.Duration
+	issuer    string
+}
+
+// NewHS256TokenManager creates a token manager that signs tokens with a shared secret
+func NewHS256TokenManager(secret []byte, expiry time.Duration) (*TokenManager, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("HS256 secret must be at least 32 bytes long")
+	}
+
+	return &TokenManager{
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+		expiry:    expiry,
+		issuer:    defaultIssuer,
+	}, nil
+}
+
+// NewEdDSATokenManager creates a token manager that signs tokens with an Ed25519 key
+func NewEdDSATokenManager(privateKey ed25519.PrivateKey, expiry time.Duration) (*TokenManager, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("Ed25519 private key must be %d bytes long", ed25519.PrivateKeySize)
+	}
+
+	return &TokenManager{
+		method:    jwt.SigningMethodEdDSA,
+		signKey:   privateKey,
+		verifyKey: privateKey.Public(),
+		expiry:    expiry,
+		issuer:    defaultIssuer,
+	}, nil
+}
+
+// NewTokenManagerFromEnv creates a token manager configured through environment variables:
+//
+//	JWT_ALGORITHM    HS256 (default) or EdDSA
+//	JWT_SECRET       shared secret for HS256
+//	JWT_PRIVATE_KEY  base64 encoded Ed25519 seed or private key for EdDSA
+//	JWT_EXPIRY       token lifetime as a Go duration, e.g. "24h" (default)
+func NewTokenManagerFromEnv() (*TokenManager, error) {
+	expiry := defaultTokenExpiry
+	if value := os.Getenv("JWT_EXPIRY"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid JWT_EXPIRY %q", value)
+		}
+		expiry = parsed
+	}
+
+	switch algorithm := os.Getenv("JWT_ALGORITHM"); algorithm {
+	case "", "HS256":
+		secret := []byte(os.Getenv("JWT_SECRET"))
+		if len(secret) == 0 {
+			// Tokens signed with a random secret do not survive a restart,
+			// which is fine for local development only
+			log.Println("Warning: JWT_SECRET is not set, using a random secret")
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, fmt.Errorf("failed to generate JWT secret: %v", err)
+			}
+		}
+		return NewHS256TokenManager(secret, expiry)
+	case "EdDSA":
+		encoded := os.Getenv("JWT_PRIVATE_KEY")
+		if encoded == "" {
+			return nil, errors.New("JWT_PRIVATE_KEY is required for EdDSA")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_PRIVATE_KEY: %v", err)
+		}
+		if len(key) == ed25519.SeedSize {
+			key = ed25519.NewKeyFromSeed(key)
+		}
+		return NewEdDSATokenManager(ed25519.PrivateKey(key), expiry)
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", algorithm)
+	}
+}
+
+// GenerateToken issues a signed token for the given user
+func (m *TokenManager) GenerateToken(user *models.User) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Role: user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			Issuer:    m.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiry)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %v", err)
+	}
+
+	return token, nil
+}
+
+// ValidateToken verifies the signature and expiry of a token and returns its claims
+func (m *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return m.verifyKey, nil
+		},
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -125,13 +126,149 @@ func createIndexes(ctx context.Context) error {
 		},
 	}
 
-	indexModels := []mongo.IndexModel{textIndexModel, filterIndexModel, locationIndexModel}
+	// Index for seller listings
+	sellerIndexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "sellerId", Value: 1},
+			{Key: "status", Value: 1},
+			{Key: "createdAt", Value: -1},
+		},
+	}
+
+	// Indexes for text filters, which match the lowercased search keys. EXACT
+	// and PREFIX filters only scan the matching keys, FUZZY ones every key.
+	brandModelIndexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+			{Key: "searchKeys.brand", Value: 1},
+			{Key: "searchKeys.model", Value: 1},
+		},
+	}
+
+	cityStateIndexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+			{Key: "searchKeys.city", Value: 1},
+			{Key: "searchKeys.state", Value: 1},
+		},
+	}
+
+	// Indexes for sorting available cars, with _id as tie-breaker. They are
+	// walked backwards for descending sorts.
+	sortIndexModels := []mongo.IndexModel{}
+	for _, field := range []string{"price", "year", "mileage", "createdAt"} {
+		sortIndexModels = append(sortIndexModels, mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "status", Value: 1},
+				{Key: field, Value: 1},
+				{Key: "_id", Value: 1},
+			},
+		})
+	}
+
+	indexModels := []mongo.IndexModel{
+		textIndexModel,
+		filterIndexModel,
+		locationIndexModel,
+		sellerIndexModel,
+		brandModelIndexModel,
+		cityStateIndexModel,
+	}
+	indexModels = append(indexModels, sortIndexModels...)
+
+	// Index for expiring listings
+	indexModels = append(indexModels, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}},
+	})
+
+	// Index for purging deleted cars
+	indexModels = append(indexModels, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"deletedAt": bson.M{"$exists": true}}),
+	})
+
+	// An active VIN can only be listed once
+	indexModels = append(indexModels, mongo.IndexModel{
+		Keys: bson.D{{Key: "activeVin", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"activeVin": bson.M{"$type": "string"}}),
+	})
+
+	// Index for searching around a point, listings without coordinates are skipped
+	indexModels = append(indexModels, mongo.IndexModel{
+		Keys: bson.D{{Key: "location.point", Value: "2dsphere"}},
+	})
 	
 	_, err := carsCollection.Indexes().CreateMany(ctx, indexModels)
 	if err != nil {
 		return fmt.Errorf("failed to create indexes for cars collection: %v", err)
 	}
 
+	// Unique index for user emails
+	usersCollection := GetCollection("users")
+
+	emailIndexModel := mongo.IndexModel{
+		Keys:    map[string]interface{}{"email": 1},
+		Options: options.Index().SetUnique(true),
+	}
+
+	// Index for claiming accounts of migrated listings
+	claimTokenIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "claimTokenHash", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"claimTokenHash": bson.M{"$exists": true}}),
+	}
+
+	_, err = usersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{emailIndexModel, claimTokenIndexModel})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes for users collection: %v", err)
+	}
+
+	// One cart per user and per guest token
+	cartsCollection := GetCollection("carts")
+
+	userCartIndexModel := mongo.IndexModel{
+		Keys: map[string]interface{}{"userId": 1},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"userId": bson.M{"$exists": true}}),
+	}
+
+	guestCartIndexModel := mongo.IndexModel{
+		Keys: map[string]interface{}{"guestToken": 1},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"guestToken": bson.M{"$exists": true}}),
+	}
+
+	// Abandoned guest carts expire after 30 days
+	guestCartExpiryIndexModel := mongo.IndexModel{
+		Keys: map[string]interface{}{"updatedAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60).
+			SetPartialFilterExpression(bson.M{"guestToken": bson.M{"$exists": true}}),
+	}
+
+	_, err = cartsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{userCartIndexModel, guestCartIndexModel, guestCartExpiryIndexModel})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes for carts collection: %v", err)
+	}
+
+	// Catalog brands are looked up by name and alias, an alias names a single brand
+	catalogCollection := GetCollection("car_catalog")
+
+	catalogNameIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	catalogKeysIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "keys", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err = catalogCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{catalogNameIndexModel, catalogKeysIndexModel})
+	if err != nil {
+		return fmt.Errorf("failed to create indexes for car catalog collection: %v", err)
+	}
+
 	log.Println("Database indexes created successfully!")
 	return nil
 }
@@ -0,0 +1,133 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register the WebP decoder
+)
+
+const (
+	// maxPixels bounds the decoded size of an image, so that small files
+	// cannot expand into huge bitmaps
+	maxPixels = 50_000_000
+	// jpegQuality is the quality of the re-encoded JPEG variants
+	jpegQuality = 85
+)
+
+var (
+	// ErrUnsupportedFormat is returned for data that is not a JPEG, PNG or WebP image
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooManyPixels is returned for images whose dimensions exceed the limit
+	ErrTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// Size is a variant to produce, fitting within MaxDimension pixels on both sides
+type Size struct {
+	Name         string
+	MaxDimension int
+}
+
+// Variant is an encoded, resized copy of an image
+type Variant struct {
+	Name        string
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Process decodes an image and encodes one variant per size. Images are never
+// upscaled. The variants are re-encoded from pixels only, so metadata such as
+// EXIF and GPS positions is dropped; the EXIF orientation is applied first so
+// that photos keep facing the right way. PNG images stay PNG to keep their
+// transparency, other images become JPEG.
+func Process(data []byte, sizes []Size) ([]Variant, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if format != "jpeg" && format != "png" && format != "webp" {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Work on the largest variant so that orienting it stays cheap
+	largest := 0
+	for _, size := range sizes {
+		largest = max(largest, size.MaxDimension)
+	}
+	base := fit(src, largest, format == "png")
+	if format == "jpeg" {
+		base = orient(base, jpegOrientation(data))
+	}
+
+	variants := make([]Variant, 0, len(sizes))
+	for _, size := range sizes {
+		img := base
+		if size.MaxDimension < largest {
+			img = fit(base, size.MaxDimension, format == "png")
+		}
+
+		var buf bytes.Buffer
+		contentType := "image/jpeg"
+		if format == "png" {
+			contentType = "image/png"
+			err = png.Encode(&buf, img)
+		} else {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bounds := img.Bounds()
+		variants = append(variants, Variant{
+			Name:        size.Name,
+			Data:        buf.Bytes(),
+			ContentType: contentType,
+			Width:       bounds.Dx(),
+			Height:      bounds.Dy(),
+		})
+	}
+
+	return variants, nil
+}
+
+// fit scales img down to fit within maxDimension pixels, keeping its aspect
+// ratio. Images without transparency are drawn over a white background.
+func fit(img image.Image, maxDimension int, transparent bool) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxDimension || height > maxDimension {
+		if width >= height {
+			width, height = maxDimension, max(1, height*maxDimension/width)
+		} else {
+			width, height = max(1, width*maxDimension/height), maxDimension
+		}
+	}
+
+	rect := image.Rect(0, 0, width, height)
+	if transparent {
+		dst := image.NewNRGBA(rect)
+		draw.CatmullRom.Scale(dst, rect, img, bounds, draw.Src, nil)
+		return dst
+	}
+
+	dst := image.NewRGBA(rect)
+	draw.Draw(dst, rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, rect, img, bounds, draw.Over, nil)
+	return dst
+}
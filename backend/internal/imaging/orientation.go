@@ -0,0 +1,122 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// jpegOrientation returns the EXIF orientation (1 to 8) of a JPEG file, or 1
+// when it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the segments up to the start of the image data
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF header
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// orient rotates and flips img so that it is displayed upright for the given
+// EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	// Orientations 5 to 8 swap the width and height
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = width-1-x, y
+			case 3: // Rotated 180
+				sx, sy = width-1-x, height-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, height-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Rotated 90 clockwise
+				sx, sy = y, height-1-x
+			case 7: // Transversed
+				sx, sy = width-1-y, height-1-x
+			case 8: // Rotated 90 counter-clockwise
+				sx, sy = width-1-y, x
+			}
+
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
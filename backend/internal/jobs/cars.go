@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/services"
+)
+
+// PurgeDeletedCars permanently removes the cars deleted more than retention ago
+func PurgeDeletedCars(cars *services.CarService, retention time.Duration) Job {
+	return Job{
+		Name:     "purge-deleted-cars",
+		Interval: time.Hour,
+		Timeout:  5 * time.Minute,
+		Run: func(ctx context.Context) error {
+			purged, err := cars.PurgeDeletedCars(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return err
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted cars", purged)
+			}
+			return nil
+		},
+	}
+}
+
+// ExpireCars moves the listings whose lifetime ended to EXPIRED
+func ExpireCars(cars *services.CarService) Job {
+	return Job{
+		Name:     "expire-cars",
+		Interval: 10 * time.Minute,
+		Timeout:  time.Minute,
+		Run: func(ctx context.Context) error {
+			expired, err := cars.ExpireCars(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if expired > 0 {
+				log.Printf("Expired %d cars", expired)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Job is a task that runs periodically in the background
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Runner runs jobs on their interval until its context is cancelled
+type Runner struct {
+	jobs []Job
+}
+
+// NewRunner creates a runner for the given jobs
+func NewRunner(jobs ...Job) *Runner {
+	return &Runner{jobs: jobs}
+}
+
+// Start runs every job once and then on its interval, each in its own
+// goroutine. It returns immediately.
+func (r *Runner) Start(ctx context.Context) {
+	for _, job := range r.jobs {
+		go r.loop(ctx, job)
+	}
+}
+
+// loop runs a job until ctx is cancelled
+func (r *Runner) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.run(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes a job once, a failing job is logged and retried on the next tick
+func (r *Runner) run(ctx context.Context, job Job) {
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = job.Interval
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := job.Run(runCtx); err != nil {
+		log.Printf("Warning: Job %s failed: %v", job.Name, err)
+	}
+}
+
+// DaysFromEnv reads a positive number of days from an environment variable,
+// returning fallback days when it is not set
+func DaysFromEnv(name string, fallback int) (time.Duration, error) {
+	days := fallback
+	if value := os.Getenv(name); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("invalid %s %q", name, value)
+		}
+		days = parsed
+	}
+
+	return time.Duration(days) * 24 * time.Hour, nil
+}
@@ -0,0 +1,88 @@
+package loaders
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+	"github.com/limosnd/marketplace-go-graphql/internal/services"
+)
+
+// batchWait is how long a loader collects keys before querying the database
+const batchWait = 2 * time.Millisecond
+
+type contextKey struct{ name string }
+
+var loadersContextKey = &contextKey{"loaders"}
+
+// Loaders batch and cache lookups by ID for the duration of a request
+type Loaders struct {
+	CarByID  *dataloader.Loader[primitive.ObjectID, *models.Car]
+	UserByID *dataloader.Loader[primitive.ObjectID, *models.User]
+}
+
+// NewLoaders creates a fresh set of loaders, one set must be used per request
+func NewLoaders(carService *services.CarService, userService *services.UserService) *Loaders {
+	return &Loaders{
+		CarByID: dataloader.NewBatchedLoader(
+			batchByID(carService.GetCarsByIDs, services.ErrCarNotFound),
+			dataloader.WithWait[primitive.ObjectID, *models.Car](batchWait),
+		),
+		UserByID: dataloader.NewBatchedLoader(
+			batchByID(userService.GetUsersByIDs, services.ErrUserNotFound),
+			dataloader.WithWait[primitive.ObjectID, *models.User](batchWait),
+		),
+	}
+}
+
+// Middleware installs a new set of loaders in the context of every request
+func Middleware(carService *services.CarService, userService *services.UserService, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), loadersContextKey, NewLoaders(carService, userService))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// For returns the loaders of the request
+func For(ctx context.Context) *Loaders {
+	return ctx.Value(loadersContextKey).(*Loaders)
+}
+
+// GetCar loads a car by ID through the request's loader
+func GetCar(ctx context.Context, id primitive.ObjectID) (*models.Car, error) {
+	return For(ctx).CarByID.Load(ctx, id)()
+}
+
+// GetUser loads a user by ID through the request's loader
+func GetUser(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return For(ctx).UserByID.Load(ctx, id)()
+}
+
+// batchByID adapts a service method fetching documents with $in to a batch
+// function, returning notFound for IDs without a document
+func batchByID[V any](
+	fetch func(context.Context, []primitive.ObjectID) (map[primitive.ObjectID]V, error),
+	notFound *apperrors.Error,
+) dataloader.BatchFunc[primitive.ObjectID, V] {
+	return func(ctx context.Context, ids []primitive.ObjectID) []*dataloader.Result[V] {
+		results := make([]*dataloader.Result[V], len(ids))
+
+		values, err := fetch(ctx, ids)
+		for i, id := range ids {
+			if err != nil {
+				results[i] = &dataloader.Result[V]{Error: err}
+			} else if value, ok := values[id]; ok {
+				results[i] = &dataloader.Result[V]{Data: value}
+			} else {
+				results[i] = &dataloader.Result[V]{Error: notFound}
+			}
+		}
+
+		return results
+	}
+}
@@ -8,24 +8,51 @@ import (
 
 // Car represents a car in the marketplace
 type Car struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Title        string             `bson:"title" json:"title"`
-	Description  string             `bson:"description" json:"description"`
-	Brand        string             `bson:"brand" json:"brand"`
-	Model        string             `bson:"model" json:"model"`
-	Year         int                `bson:"year" json:"year"`
-	Price        float64            `bson:"price" json:"price"`
-	Mileage      int                `bson:"mileage" json:"mileage"`
-	Color        string             `bson:"color" json:"color"`
-	FuelType     FuelType           `bson:"fuelType" json:"fuelType"`
-	Transmission TransmissionType   `bson:"transmission" json:"transmission"`
-	Status       CarStatus          `bson:"status" json:"status"`
-	Images       []string           `bson:"images" json:"images"`
-	Seller       User               `bson:"seller" json:"seller"`
-	Location     Location           `bson:"location" json:"location"`
-	Features     []string           `bson:"features" json:"features"`
-	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Title         string             `bson:"title" json:"title"`
+	Description   string             `bson:"description" json:"description"`
+	Brand         string             `bson:"brand" json:"brand"`
+	Model         string             `bson:"model" json:"model"`
+	Year          int                `bson:"year" json:"year"`
+	Price         float64            `bson:"price" json:"price"`
+	Mileage       int                `bson:"mileage" json:"mileage"`
+	Color         string             `bson:"color" json:"color"`
+	FuelType      FuelType           `bson:"fuelType" json:"fuelType"`
+	Transmission  TransmissionType   `bson:"transmission" json:"transmission"`
+	VIN           *string            `bson:"vin,omitempty" json:"vin"`
+	ActiveVIN     *string            `bson:"activeVin,omitempty" json:"-"` // VIN reserved by a listed car, unique
+	Status        CarStatus          `bson:"status" json:"status"`
+	Images        []CarImage         `bson:"images" json:"images"`
+	SellerID      primitive.ObjectID `bson:"sellerId,omitempty" json:"sellerId"`
+	Location      Location           `bson:"location" json:"location"`
+	SearchKeys    CarSearchKeys      `bson:"searchKeys" json:"-"`
+	Features      []string           `bson:"features" json:"features"`
+	StatusHistory []StatusChange     `bson:"statusHistory,omitempty" json:"statusHistory"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+	DeletedAt     *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt"`
+	ExpiresAt     *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt"`
+	Score         *float64           `bson:"score,omitempty" json:"score,omitempty"`           // Text search relevance, never stored
+	DistanceKm    *float64           `bson:"distanceKm,omitempty" json:"distanceKm,omitempty"` // Distance to a near filter, never stored
+}
+
+// CarSearchKeys are the lowercased free text fields of a car, which text
+// filters match with case-sensitive expressions so that indexes bound them
+type CarSearchKeys struct {
+	Brand string `bson:"brand"`
+	Model string `bson:"model"`
+	City  string `bson:"city"`
+	State string `bson:"state"`
+}
+
+// IsAvailable reports whether the car can still be bought
+func (c *Car) IsAvailable() bool {
+	return c.Status == CarStatusAvailable && c.DeletedAt == nil
+}
+
+// IsOwnedBy reports whether the car was listed by the given user
+func (c *Car) IsOwnedBy(user *User) bool {
+	return user != nil && !c.SellerID.IsZero() && c.SellerID == user.ID
 }
 
 // User represents a user in the system
@@ -41,13 +68,83 @@ type User struct {
 	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
+// CarImage is a photo of a listing in several sizes. Images uploaded before
+// variants existed, or given as URLs, only have a FULL variant.
+type CarImage struct {
+	ID       string         `bson:"_id" json:"id"`
+	Variants []ImageVariant `bson:"variants" json:"variants"`
+	IsCover  bool           `bson:"isCover" json:"isCover"`
+}
+
+// ImageVariant is one size of a car image
+type ImageVariant struct {
+	Size   ImageSize `bson:"size" json:"size"`
+	URL    string    `bson:"url" json:"url"`
+	Key    string    `bson:"key,omitempty" json:"-"` // Blob key of uploaded images
+	Width  int       `bson:"width,omitempty" json:"width"`
+	Height int       `bson:"height,omitempty" json:"height"`
+}
+
+// Variant returns the variant of the given size, falling back to the FULL
+// one for images that do not have it
+func (i *CarImage) Variant(size ImageSize) *ImageVariant {
+	for _, wanted := range []ImageSize{size, ImageSizeFull} {
+		for j := range i.Variants {
+			if i.Variants[j].Size == wanted {
+				return &i.Variants[j]
+			}
+		}
+	}
+	if len(i.Variants) > 0 {
+		return &i.Variants[0]
+	}
+	return nil
+}
+
+// ImageSize represents a variant size of an image
+type ImageSize string
+
+const (
+	ImageSizeThumbnail ImageSize = "THUMBNAIL"
+	ImageSizeMedium    ImageSize = "MEDIUM"
+	ImageSizeFull      ImageSize = "FULL"
+)
+
+// CatalogBrand is a car make of the catalog with its models. Keys holds the
+// lowercased name and aliases that inputs are matched against.
+type CatalogBrand struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name    string             `bson:"name" json:"name"`
+	Aliases []string           `bson:"aliases" json:"aliases"`
+	Models  []CatalogModel     `bson:"models" json:"models"`
+	Keys    []string           `bson:"keys" json:"-"`
+}
+
+// CatalogModel is a model of a catalog brand
+type CatalogModel struct {
+	Name    string   `bson:"name" json:"name"`
+	Aliases []string `bson:"aliases" json:"aliases"`
+}
+
 // Location represents a geographical location
 type Location struct {
-	City    string   `bson:"city" json:"city"`
-	State   string   `bson:"state" json:"state"`
-	Country string   `bson:"country" json:"country"`
-	Lat     *float64 `bson:"lat,omitempty" json:"lat"`
-	Lng     *float64 `bson:"lng,omitempty" json:"lng"`
+	City    string    `bson:"city" json:"city"`
+	State   string    `bson:"state" json:"state"`
+	Country string    `bson:"country" json:"country"`
+	Lat     *float64  `bson:"lat,omitempty" json:"lat"`
+	Lng     *float64  `bson:"lng,omitempty" json:"lng"`
+	Point   *GeoPoint `bson:"point,omitempty" json:"-"` // GeoJSON copy of Lat/Lng for the 2dsphere index
+}
+
+// GeoPoint is a GeoJSON point, coordinates are longitude first
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPoint returns the GeoJSON point at the given latitude and longitude
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
 }
 
 // FuelType represents the fuel type of a car
@@ -75,6 +172,47 @@ const (
 	CarStatusAvailable CarStatus = "AVAILABLE"
 	CarStatusSold      CarStatus = "SOLD"
 	CarStatusPending   CarStatus = "PENDING"
+	CarStatusDraft     CarStatus = "DRAFT"
+	CarStatusWithdrawn CarStatus = "WITHDRAWN"
+	CarStatusExpired   CarStatus = "EXPIRED"
+)
+
+// StatusChange records a transition in the lifecycle of a listing. From is
+// nil for the initial status and ActorID is nil for automatic transitions.
+type StatusChange struct {
+	From    *CarStatus          `bson:"from,omitempty" json:"from"`
+	To      CarStatus           `bson:"to" json:"to"`
+	ActorID *primitive.ObjectID `bson:"actorId,omitempty" json:"actorId"`
+	At      time.Time           `bson:"at" json:"at"`
+}
+
+// TextMatchMode represents how free text filters are matched
+type TextMatchMode string
+
+const (
+	TextMatchModeExact  TextMatchMode = "EXACT"
+	TextMatchModePrefix TextMatchMode = "PREFIX"
+	TextMatchModeFuzzy  TextMatchMode = "FUZZY"
+)
+
+// CarSortField represents a field cars can be sorted by
+type CarSortField string
+
+const (
+	CarSortFieldPrice     CarSortField = "PRICE"
+	CarSortFieldYear      CarSortField = "YEAR"
+	CarSortFieldMileage   CarSortField = "MILEAGE"
+	CarSortFieldCreatedAt CarSortField = "CREATED_AT"
+	CarSortFieldRelevance CarSortField = "RELEVANCE"
+	CarSortFieldDistance  CarSortField = "DISTANCE"
+)
+
+// SortDirection represents the direction of a sort
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
 )
 
 // UserRole represents the role of a user
@@ -89,19 +227,24 @@ const (
 // CartItem represents an item in a user's shopping cart
 type CartItem struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID   primitive.ObjectID `bson:"userId" json:"userId"`
+	UserID   primitive.ObjectID `bson:"userId,omitempty" json:"userId"` // Only set on legacy cart_items documents
 	CarID    primitive.ObjectID `bson:"carId" json:"carId"`
 	Car      *Car               `bson:"car,omitempty" json:"car"`
 	Quantity int                `bson:"quantity" json:"quantity"`
 	AddedAt  time.Time          `bson:"addedAt" json:"addedAt"`
+	// Available is false for cars that were sold or deleted since they were added
+	Available bool `bson:"-" json:"available"`
 }
 
-// Cart represents a user's shopping cart
+// Cart represents a user's or a guest's shopping cart
 type Cart struct {
-	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID primitive.ObjectID `bson:"userId" json:"userId"`
-	Items  []CartItem         `bson:"items" json:"items"`
-	Total  float64            `bson:"total" json:"total"`
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId,omitempty" json:"userId"`
+	GuestToken *string            `bson:"guestToken,omitempty" json:"guestToken"`
+	Items      []CartItem         `bson:"items" json:"items"`
+	Total      float64            `bson:"total,omitempty" json:"total"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
 // LoginInput represents login credentials
@@ -112,10 +255,11 @@ type LoginInput struct {
 
 // RegisterInput represents registration data
 type RegisterInput struct {
-	Name     string  `json:"name"`
-	Email    string  `json:"email"`
-	Password string  `json:"password"`
-	Phone    *string `json:"phone,omitempty"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Password string    `json:"password"`
+	Phone    *string   `json:"phone,omitempty"`
+	Role     *UserRole `json:"role,omitempty"`
 }
 
 // AuthResponse represents authentication response
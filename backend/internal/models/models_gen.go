@@ -7,6 +7,42 @@ type AddToCartInput struct {
 	Quantity int    `json:"quantity"`
 }
 
+type CarConnection struct {
+	Edges    []*CarEdge `json:"edges"`
+	PageInfo *PageInfo  `json:"pageInfo"`
+}
+
+type CarDraftInput struct {
+	ID           *string           `json:"id,omitempty"`
+	Title        *string           `json:"title,omitempty"`
+	Description  *string           `json:"description,omitempty"`
+	Brand        *string           `json:"brand,omitempty"`
+	Model        *string           `json:"model,omitempty"`
+	Year         *int              `json:"year,omitempty"`
+	Price        *float64          `json:"price,omitempty"`
+	Mileage      *int              `json:"mileage,omitempty"`
+	Color        *string           `json:"color,omitempty"`
+	FuelType     *FuelType         `json:"fuelType,omitempty"`
+	Transmission *TransmissionType `json:"transmission,omitempty"`
+	Vin          *string           `json:"vin,omitempty"`
+	Images       []string          `json:"images,omitempty"`
+	Location     *LocationInput    `json:"location,omitempty"`
+	Features     []string          `json:"features,omitempty"`
+}
+
+type CarEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Car   `json:"node"`
+}
+
+type CarFacets struct {
+	Brands        []*FacetCount  `json:"brands"`
+	FuelTypes     []*FacetCount  `json:"fuelTypes"`
+	Transmissions []*FacetCount  `json:"transmissions"`
+	Years         []*FacetCount  `json:"years"`
+	Prices        []*PriceBucket `json:"prices"`
+}
+
 type CarFilterInput struct {
 	Brand        *string           `json:"brand,omitempty"`
 	Model        *string           `json:"model,omitempty"`
@@ -20,6 +56,9 @@ type CarFilterInput struct {
 	Transmission *TransmissionType `json:"transmission,omitempty"`
 	City         *string           `json:"city,omitempty"`
 	State        *string           `json:"state,omitempty"`
+	SellerID     *string           `json:"sellerId,omitempty"`
+	MatchMode    *TextMatchMode    `json:"matchMode,omitempty"`
+	Near         *NearInput        `json:"near,omitempty"`
 }
 
 type CarInput struct {
@@ -33,12 +72,18 @@ type CarInput struct {
 	Color        string           `json:"color"`
 	FuelType     FuelType         `json:"fuelType"`
 	Transmission TransmissionType `json:"transmission"`
+	Vin          *string          `json:"vin,omitempty"`
 	Images       []string         `json:"images"`
 	Location     *LocationInput   `json:"location"`
 	Features     []string         `json:"features"`
-	SellerName   string           `json:"sellerName"`
-	SellerEmail  string           `json:"sellerEmail"`
-	SellerPhone  string           `json:"sellerPhone"`
+	SellerName   *string          `json:"sellerName,omitempty"`
+	SellerEmail  *string          `json:"sellerEmail,omitempty"`
+	SellerPhone  *string          `json:"sellerPhone,omitempty"`
+}
+
+type CarSortInput struct {
+	Field     CarSortField   `json:"field"`
+	Direction *SortDirection `json:"direction,omitempty"`
 }
 
 type CarsResponse struct {
@@ -49,6 +94,11 @@ type CarsResponse struct {
 	TotalPages int    `json:"totalPages"`
 }
 
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
 type LocationInput struct {
 	City    string   `json:"city"`
 	State   string   `json:"state"`
@@ -60,6 +110,25 @@ type LocationInput struct {
 type Mutation struct {
 }
 
+type NearInput struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	RadiusKm float64 `json:"radiusKm"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
 type Query struct {
 }
 
@@ -75,6 +144,7 @@ type UpdateCarInput struct {
 	Color        *string           `json:"color,omitempty"`
 	FuelType     *FuelType         `json:"fuelType,omitempty"`
 	Transmission *TransmissionType `json:"transmission,omitempty"`
+	Vin          *string           `json:"vin,omitempty"`
 	Status       *CarStatus        `json:"status,omitempty"`
 	Images       []string          `json:"images,omitempty"`
 	Location     *LocationInput    `json:"location,omitempty"`
@@ -0,0 +1,118 @@
+package resolvers
+
+import (
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+	"github.com/limosnd/marketplace-go-graphql/internal/services"
+)
+
+// toServiceFilter converts the GraphQL car filter to the service filter
+func toServiceFilter(filter *models.CarFilterInput) *services.CarFilterInput {
+	if filter == nil {
+		return nil
+	}
+
+	serviceFilter := &services.CarFilterInput{
+		Brand:      filter.Brand,
+		Model:      filter.Model,
+		MinYear:    filter.MinYear,
+		MaxYear:    filter.MaxYear,
+		MinPrice:   filter.MinPrice,
+		MaxPrice:   filter.MaxPrice,
+		MinMileage: filter.MinMileage,
+		MaxMileage: filter.MaxMileage,
+		City:       filter.City,
+		State:      filter.State,
+		SellerID:   filter.SellerID,
+		MatchMode:  filter.MatchMode,
+	}
+
+	if filter.Near != nil {
+		serviceFilter.Near = &services.NearInput{
+			Lat:      filter.Near.Lat,
+			Lng:      filter.Near.Lng,
+			RadiusKm: filter.Near.RadiusKm,
+		}
+	}
+
+	if filter.FuelType != nil {
+		fuelType := models.FuelType(*filter.FuelType)
+		serviceFilter.FuelType = &fuelType
+	}
+
+	if filter.Transmission != nil {
+		transmission := models.TransmissionType(*filter.Transmission)
+		serviceFilter.Transmission = &transmission
+	}
+
+	return serviceFilter
+}
+
+// toServiceSort converts the GraphQL car sort to the service sort
+func toServiceSort(sort *models.CarSortInput) *services.CarSortInput {
+	if sort == nil {
+		return nil
+	}
+
+	serviceSort := &services.CarSortInput{
+		Field:     sort.Field,
+		Direction: models.SortDirectionDesc,
+	}
+	if sort.Direction != nil {
+		serviceSort.Direction = *sort.Direction
+	}
+
+	return serviceSort
+}
+
+// toCarsResponse converts a service response to the GraphQL response
+func toCarsResponse(response *services.CarsResponse) *models.CarsResponse {
+	return &models.CarsResponse{
+		Cars:       response.Cars,
+		Total:      response.Total,
+		Page:       response.Page,
+		Limit:      response.Limit,
+		TotalPages: response.TotalPages,
+	}
+}
+
+// toCarConnection converts a service connection to the GraphQL connection
+func toCarConnection(connection *services.CarConnection) *models.CarConnection {
+	result := &models.CarConnection{
+		Edges: make([]*models.CarEdge, len(connection.Edges)),
+		PageInfo: &models.PageInfo{
+			HasNextPage:     connection.HasNextPage,
+			HasPreviousPage: connection.HasPreviousPage,
+		},
+	}
+
+	for i, edge := range connection.Edges {
+		result.Edges[i] = &models.CarEdge{Cursor: edge.Cursor, Node: edge.Node}
+	}
+
+	if len(result.Edges) > 0 {
+		result.PageInfo.StartCursor = &result.Edges[0].Cursor
+		result.PageInfo.EndCursor = &result.Edges[len(result.Edges)-1].Cursor
+	}
+
+	return result
+}
+
+// pagination applies the default page and limit
+func pagination(page *int, limit *int) (int, int) {
+	p, l := 1, 10
+	if page != nil {
+		p = *page
+	}
+	if limit != nil {
+		l = *limit
+	}
+	return p, l
+}
+
+// imageVariant returns the variant of an image for the requested size, FULL by default
+func imageVariant(image *models.CarImage, size *models.ImageSize) *models.ImageVariant {
+	if size == nil {
+		return image.Variant(models.ImageSizeFull)
+	}
+	return image.Variant(*size)
+}
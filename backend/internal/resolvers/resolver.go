@@ -1,8 +1,14 @@
 package resolvers
 
 import (
-	"go.mongodb.org/mongo-driver/mongo"
+	"context"
+	"log"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/auth"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
 	"github.com/limosnd/marketplace-go-graphql/internal/services"
+	"github.com/limosnd/marketplace-go-graphql/internal/storage"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // This file will not be regenerated automatically.
@@ -10,18 +16,60 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	DB          *mongo.Database
-	CarService  *services.CarService
-	UserService *services.UserService
-	CartService *services.CartService
+	DB             *mongo.Database
+	CarService     *services.CarService
+	UserService    *services.UserService
+	CartService    *services.CartService
+	ImageService   *services.ImageService
+	CatalogService *services.CatalogService
+	Tokens         *auth.TokenManager
 }
 
 // NewResolver creates a new resolver with all necessary services
-func NewResolver(db *mongo.Database) *Resolver {
+func NewResolver(db *mongo.Database, tokens *auth.TokenManager, store storage.BlobStore) *Resolver {
+	carService := services.NewCarService()
+
 	return &Resolver{
-		DB:          db,
-		CarService:  services.NewCarService(),
-		UserService: services.NewUserService(),
-		CartService: services.NewCartService(),
+		DB:             db,
+		CarService:     carService,
+		UserService:    services.NewUserService(),
+		CartService:    services.NewCartService(),
+		ImageService:   services.NewImageService(carService, store),
+		CatalogService: services.NewCatalogService(),
+		Tokens:         tokens,
+	}
+}
+
+// authResponse issues a token for an authenticated user
+func (r *Resolver) authResponse(user *models.User) (*models.AuthResponse, error) {
+	token, err := r.Tokens.GenerateToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthResponse{
+		Token: token,
+		User:  user,
+	}, nil
+}
+
+// cartOwner identifies the cart of the current request: the user's cart when
+// authenticated, otherwise the guest cart named by the X-Cart-Token header
+func cartOwner(ctx context.Context) services.CartOwner {
+	if user := auth.UserFromContext(ctx); user != nil {
+		return services.CartOwner{UserID: user.ID}
+	}
+	return services.CartOwner{GuestToken: auth.GuestTokenFromContext(ctx)}
+}
+
+// mergeGuestCart moves the guest cart of the request into the user's cart
+func (r *Resolver) mergeGuestCart(ctx context.Context, user *models.User) {
+	guestToken := auth.GuestTokenFromContext(ctx)
+	if guestToken == "" {
+		return
+	}
+
+	if _, err := r.CartService.MergeGuestCart(ctx, user.ID, guestToken); err != nil {
+		log.Printf("Failed to merge guest cart: %v", err)
 	}
 }
@@ -6,11 +6,14 @@ package resolvers
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/limosnd/marketplace-go-graphql/internal/auth"
 	"github.com/limosnd/marketplace-go-graphql/internal/generated"
+	"github.com/limosnd/marketplace-go-graphql/internal/loaders"
 	"github.com/limosnd/marketplace-go-graphql/internal/models"
 	"github.com/limosnd/marketplace-go-graphql/internal/services"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // ID is the resolver for the id field.
@@ -18,9 +21,89 @@ func (r *carResolver) ID(ctx context.Context, obj *models.Car) (string, error) {
 	return obj.ID.Hex(), nil
 }
 
+// FuelType is the resolver for the fuelType field.
+func (r *carResolver) FuelType(ctx context.Context, obj *models.Car) (*models.FuelType, error) {
+	if obj.FuelType == "" {
+		return nil, nil // Draft without a fuel type yet
+	}
+	return &obj.FuelType, nil
+}
+
+// Transmission is the resolver for the transmission field.
+func (r *carResolver) Transmission(ctx context.Context, obj *models.Car) (*models.TransmissionType, error) {
+	if obj.Transmission == "" {
+		return nil, nil // Draft without a transmission yet
+	}
+	return &obj.Transmission, nil
+}
+
+// ImageUrls is the resolver for the imageUrls field.
+func (r *carResolver) ImageUrls(ctx context.Context, obj *models.Car) ([]string, error) {
+	urls := make([]string, 0, len(obj.Images))
+	for i := range obj.Images {
+		if variant := obj.Images[i].Variant(models.ImageSizeFull); variant != nil {
+			urls = append(urls, variant.URL)
+		}
+	}
+	return urls, nil
+}
+
+// Seller is the resolver for the seller field.
+func (r *carResolver) Seller(ctx context.Context, obj *models.Car) (*models.User, error) {
+	return loaders.GetUser(ctx, obj.SellerID)
+}
+
+// StatusHistory is the resolver for the statusHistory field.
+func (r *carResolver) StatusHistory(ctx context.Context, obj *models.Car) ([]*models.StatusChange, error) {
+	// Who changed the status is only shown to the owner and admins
+	viewer := auth.UserFromContext(ctx)
+	showActors := obj.IsOwnedBy(viewer) || (viewer != nil && viewer.Role == models.UserRoleAdmin)
+
+	history := make([]*models.StatusChange, len(obj.StatusHistory))
+	for i := range obj.StatusHistory {
+		change := obj.StatusHistory[i]
+		if !showActors {
+			change.ActorID = nil
+		}
+		history[i] = &change
+	}
+	return history, nil
+}
+
+// URL is the resolver for the url field.
+func (r *carImageResolver) URL(ctx context.Context, obj *models.CarImage, size *models.ImageSize) (string, error) {
+	variant := imageVariant(obj, size)
+	if variant == nil {
+		return "", nil
+	}
+	return variant.URL, nil
+}
+
+// Width is the resolver for the width field.
+func (r *carImageResolver) Width(ctx context.Context, obj *models.CarImage, size *models.ImageSize) (*int, error) {
+	variant := imageVariant(obj, size)
+	if variant == nil || variant.Width == 0 {
+		return nil, nil // Dimensions of external images are unknown
+	}
+	return &variant.Width, nil
+}
+
+// Height is the resolver for the height field.
+func (r *carImageResolver) Height(ctx context.Context, obj *models.CarImage, size *models.ImageSize) (*int, error) {
+	variant := imageVariant(obj, size)
+	if variant == nil || variant.Height == 0 {
+		return nil, nil // Dimensions of external images are unknown
+	}
+	return &variant.Height, nil
+}
+
 // ID is the resolver for the id field.
-func (r *cartResolver) ID(ctx context.Context, obj *models.Cart) (string, error) {
-	return obj.ID.Hex(), nil
+func (r *cartResolver) ID(ctx context.Context, obj *models.Cart) (*string, error) {
+	if obj.ID.IsZero() {
+		return nil, nil // Guest cart that is not stored yet
+	}
+	id := obj.ID.Hex()
+	return &id, nil
 }
 
 // ItemCount is the resolver for the itemCount field.
@@ -33,23 +116,74 @@ func (r *cartItemResolver) ID(ctx context.Context, obj *models.CartItem) (string
 	return obj.ID.Hex(), nil
 }
 
+// Car is the resolver for the car field.
+func (r *cartItemResolver) Car(ctx context.Context, obj *models.CartItem) (*models.Car, error) {
+	if obj.Car != nil {
+		return obj.Car, nil
+	}
+	return loaders.GetCar(ctx, obj.CarID)
+}
+
 // Login is the resolver for the login field.
 func (r *mutationResolver) Login(ctx context.Context, input models.LoginInput) (*models.AuthResponse, error) {
-	panic(fmt.Errorf("not implemented: Login - login"))
+	user, err := r.UserService.Login(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mergeGuestCart(ctx, user)
+	return r.authResponse(user)
 }
 
 // Register is the resolver for the register field.
 func (r *mutationResolver) Register(ctx context.Context, input models.RegisterInput) (*models.AuthResponse, error) {
-	panic(fmt.Errorf("not implemented: Register - register"))
+	user, err := r.UserService.Register(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mergeGuestCart(ctx, user)
+	return r.authResponse(user)
 }
 
 // UpdateProfile is the resolver for the updateProfile field.
 func (r *mutationResolver) UpdateProfile(ctx context.Context, input models.UpdateUserInput) (*models.User, error) {
-	panic(fmt.Errorf("not implemented: UpdateProfile - updateProfile"))
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.UserService.UpdateProfile(ctx, user, &input)
+}
+
+// ClaimAccount is the resolver for the claimAccount field.
+func (r *mutationResolver) ClaimAccount(ctx context.Context, token string, password string) (*models.AuthResponse, error) {
+	user, err := r.UserService.ClaimAccount(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mergeGuestCart(ctx, user)
+	return r.authResponse(user)
+}
+
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, userID string, role models.UserRole) (*models.User, error) {
+	return r.UserService.UpdateUser(ctx, userID, bson.M{"role": role})
+}
+
+// CreateClaimToken is the resolver for the createClaimToken field.
+func (r *mutationResolver) CreateClaimToken(ctx context.Context, userID string) (string, error) {
+	return r.UserService.CreateClaimToken(ctx, userID)
 }
 
 // CreateCar is the resolver for the createCar field.
 func (r *mutationResolver) CreateCar(ctx context.Context, input models.CarInput) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert GraphQL input to service input
 	serviceInput := &services.CarInput{
 		Title:        input.Title,
@@ -62,6 +196,7 @@ func (r *mutationResolver) CreateCar(ctx context.Context, input models.CarInput)
 		Color:        input.Color,
 		FuelType:     models.FuelType(input.FuelType),
 		Transmission: models.TransmissionType(input.Transmission),
+		VIN:          input.Vin,
 		Images:       input.Images,
 		Location: services.LocationInput{
 			City:    input.Location.City,
@@ -70,17 +205,58 @@ func (r *mutationResolver) CreateCar(ctx context.Context, input models.CarInput)
 			Lat:     input.Location.Lat,
 			Lng:     input.Location.Lng,
 		},
-		Features:    input.Features,
-		SellerName:  input.SellerName,
-		SellerEmail: input.SellerEmail,
-		SellerPhone: input.SellerPhone,
+		Features: input.Features,
+	}
+
+	return r.CarService.CreateCar(ctx, user, serviceInput)
+}
+
+// SaveCarDraft is the resolver for the saveCarDraft field.
+func (r *mutationResolver) SaveCarDraft(ctx context.Context, input models.CarDraftInput) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drafts share the partial fields of an update
+	serviceInput := &services.UpdateCarInput{
+		Title:        input.Title,
+		Description:  input.Description,
+		Brand:        input.Brand,
+		Model:        input.Model,
+		Year:         input.Year,
+		Price:        input.Price,
+		Mileage:      input.Mileage,
+		Color:        input.Color,
+		FuelType:     input.FuelType,
+		Transmission: input.Transmission,
+		VIN:          input.Vin,
+		Images:       input.Images,
+		Features:     input.Features,
+	}
+	if input.ID != nil {
+		serviceInput.ID = *input.ID
+	}
+	if input.Location != nil {
+		serviceInput.Location = &services.LocationInput{
+			City:    input.Location.City,
+			State:   input.Location.State,
+			Country: input.Location.Country,
+			Lat:     input.Location.Lat,
+			Lng:     input.Location.Lng,
+		}
 	}
 
-	return r.CarService.CreateCar(ctx, serviceInput)
+	return r.CarService.SaveCarDraft(ctx, user, serviceInput)
 }
 
 // UpdateCar is the resolver for the updateCar field.
 func (r *mutationResolver) UpdateCar(ctx context.Context, input models.UpdateCarInput) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert GraphQL input to service input
 	serviceInput := &services.UpdateCarInput{
 		ID: input.ID,
@@ -119,6 +295,9 @@ func (r *mutationResolver) UpdateCar(ctx context.Context, input models.UpdateCar
 		transmission := models.TransmissionType(*input.Transmission)
 		serviceInput.Transmission = &transmission
 	}
+	if input.Vin != nil {
+		serviceInput.VIN = input.Vin
+	}
 	if input.Status != nil {
 		status := models.CarStatus(*input.Status)
 		serviceInput.Status = &status
@@ -139,101 +318,237 @@ func (r *mutationResolver) UpdateCar(ctx context.Context, input models.UpdateCar
 		serviceInput.Features = input.Features
 	}
 
-	return r.CarService.UpdateCar(ctx, serviceInput)
+	return r.CarService.UpdateCar(ctx, user, serviceInput)
 }
 
 // DeleteCar is the resolver for the deleteCar field.
 func (r *mutationResolver) DeleteCar(ctx context.Context, id string) (bool, error) {
-	return r.CarService.DeleteCar(ctx, id)
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return r.CarService.DeleteCar(ctx, user, id)
+}
+
+// RestoreCar is the resolver for the restoreCar field.
+func (r *mutationResolver) RestoreCar(ctx context.Context, id string) (*models.Car, error) {
+	return r.CarService.RestoreCar(ctx, id)
+}
+
+// PublishCar is the resolver for the publishCar field.
+func (r *mutationResolver) PublishCar(ctx context.Context, id string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CarService.ChangeStatus(ctx, user, id, models.CarStatusAvailable)
+}
+
+// MarkCarPending is the resolver for the markCarPending field.
+func (r *mutationResolver) MarkCarPending(ctx context.Context, id string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CarService.ChangeStatus(ctx, user, id, models.CarStatusPending)
+}
+
+// MarkCarSold is the resolver for the markCarSold field.
+func (r *mutationResolver) MarkCarSold(ctx context.Context, id string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CarService.ChangeStatus(ctx, user, id, models.CarStatusSold)
+}
+
+// WithdrawCar is the resolver for the withdrawCar field.
+func (r *mutationResolver) WithdrawCar(ctx context.Context, id string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CarService.ChangeStatus(ctx, user, id, models.CarStatusWithdrawn)
+}
+
+// RenewCar is the resolver for the renewCar field.
+func (r *mutationResolver) RenewCar(ctx context.Context, id string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CarService.RenewCar(ctx, user, id)
+}
+
+// UploadCarImage is the resolver for the uploadCarImage field.
+func (r *mutationResolver) UploadCarImage(ctx context.Context, carID string, file graphql.Upload) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ImageService.UploadCarImage(ctx, user, carID, services.ImageUpload{
+		File:        file.File,
+		Filename:    file.Filename,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+	})
+}
+
+// ReorderCarImages is the resolver for the reorderCarImages field.
+func (r *mutationResolver) ReorderCarImages(ctx context.Context, carID string, imageIds []string, coverImageID *string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ImageService.ReorderCarImages(ctx, user, carID, imageIds, coverImageID)
+}
+
+// DeleteCarImage is the resolver for the deleteCarImage field.
+func (r *mutationResolver) DeleteCarImage(ctx context.Context, carID string, imageID string) (*models.Car, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ImageService.DeleteCarImage(ctx, user, carID, imageID)
 }
 
 // AddToCart is the resolver for the addToCart field.
 func (r *mutationResolver) AddToCart(ctx context.Context, input models.AddToCartInput) (*models.Cart, error) {
-	panic(fmt.Errorf("not implemented: AddToCart - addToCart"))
+	return r.CartService.AddToCart(ctx, cartOwner(ctx), input.CarID, input.Quantity)
 }
 
 // RemoveFromCart is the resolver for the removeFromCart field.
 func (r *mutationResolver) RemoveFromCart(ctx context.Context, carID string) (*models.Cart, error) {
-	panic(fmt.Errorf("not implemented: RemoveFromCart - removeFromCart"))
+	return r.CartService.RemoveFromCart(ctx, cartOwner(ctx), carID)
 }
 
 // ClearCart is the resolver for the clearCart field.
 func (r *mutationResolver) ClearCart(ctx context.Context) (bool, error) {
-	panic(fmt.Errorf("not implemented: ClearCart - clearCart"))
+	if err := r.CartService.ClearCart(ctx, cartOwner(ctx)); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-// Cars is the resolver for the cars field.
-func (r *queryResolver) Cars(ctx context.Context, filter *models.CarFilterInput, page *int, limit *int) (*models.CarsResponse, error) {
-	// Set defaults
-	if page == nil {
-		defaultPage := 1
-		page = &defaultPage
-	}
-	if limit == nil {
-		defaultLimit := 10
-		limit = &defaultLimit
-	}
-
-	// Convert GraphQL filter to service filter
-	var serviceFilter *services.CarFilterInput
-	if filter != nil {
-		serviceFilter = &services.CarFilterInput{
-			Brand:      filter.Brand,
-			Model:      filter.Model,
-			MinYear:    filter.MinYear,
-			MaxYear:    filter.MaxYear,
-			MinPrice:   filter.MinPrice,
-			MaxPrice:   filter.MaxPrice,
-			MinMileage: filter.MinMileage,
-			MaxMileage: filter.MaxMileage,
-			City:       filter.City,
-			State:      filter.State,
-		}
+// MergeCart is the resolver for the mergeCart field.
+func (r *mutationResolver) MergeCart(ctx context.Context, guestToken string) (*models.Cart, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-		if filter.FuelType != nil {
-			fuelType := models.FuelType(*filter.FuelType)
-			serviceFilter.FuelType = &fuelType
-		}
+	return r.CartService.MergeGuestCart(ctx, user.ID, guestToken)
+}
 
-		if filter.Transmission != nil {
-			transmission := models.TransmissionType(*filter.Transmission)
-			serviceFilter.Transmission = &transmission
-		}
+// Cars is the resolver for the cars field.
+func (r *queryResolver) Cars(ctx context.Context, filter *models.CarFilterInput, sort *models.CarSortInput, page *int, limit *int) (*models.CarsResponse, error) {
+	p, l := pagination(page, limit)
+
+	response, err := r.CarService.GetCars(ctx, toServiceFilter(filter), toServiceSort(sort), p, l)
+	if err != nil {
+		return nil, err
 	}
 
-	response, err := r.CarService.GetCars(ctx, serviceFilter, *page, *limit)
+	return toCarsResponse(response), nil
+}
+
+// CarsConnection is the resolver for the carsConnection field.
+func (r *queryResolver) CarsConnection(ctx context.Context, filter *models.CarFilterInput, sort *models.CarSortInput, first *int, after *string, last *int, before *string) (*models.CarConnection, error) {
+	args := services.ConnectionArgs{First: first, After: after, Last: last, Before: before}
+
+	connection, err := r.CarService.GetCarsConnection(ctx, toServiceFilter(filter), toServiceSort(sort), args)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert service response to GraphQL response
-	return &models.CarsResponse{
-		Cars:       response.Cars,
-		Total:      response.Total,
-		Page:       response.Page,
-		Limit:      response.Limit,
-		TotalPages: response.TotalPages,
-	}, nil
+	return toCarConnection(connection), nil
+}
+
+// CarFacets is the resolver for the carFacets field.
+func (r *queryResolver) CarFacets(ctx context.Context, filter *models.CarFilterInput) (*models.CarFacets, error) {
+	return r.CarService.GetCarFacets(ctx, toServiceFilter(filter))
 }
 
 // Car is the resolver for the car field.
 func (r *queryResolver) Car(ctx context.Context, id string) (*models.Car, error) {
-	return r.CarService.GetCarByID(ctx, id)
+	return r.CarService.GetVisibleCar(ctx, auth.UserFromContext(ctx), id)
 }
 
 // SearchCars is the resolver for the searchCars field.
-func (r *queryResolver) SearchCars(ctx context.Context, query string, page *int, limit *int) (*models.CarsResponse, error) {
-	panic(fmt.Errorf("not implemented: SearchCars - searchCars"))
+func (r *queryResolver) SearchCars(ctx context.Context, query string, filter *models.CarFilterInput, sort *models.CarSortInput, page *int, limit *int) (*models.CarsResponse, error) {
+	p, l := pagination(page, limit)
+
+	response, err := r.CarService.SearchCars(ctx, query, toServiceFilter(filter), toServiceSort(sort), p, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return toCarsResponse(response), nil
+}
+
+// Brands is the resolver for the brands field.
+func (r *queryResolver) Brands(ctx context.Context) ([]string, error) {
+	return r.CatalogService.Brands(ctx)
+}
+
+// Models is the resolver for the models field.
+func (r *queryResolver) Models(ctx context.Context, brand string) ([]string, error) {
+	return r.CatalogService.Models(ctx, brand)
 }
 
 // Me is the resolver for the me field.
 func (r *queryResolver) Me(ctx context.Context) (*models.User, error) {
-	panic(fmt.Errorf("not implemented: Me - me"))
+	return auth.UserFromContext(ctx), nil
+}
+
+// MyCars is the resolver for the myCars field.
+func (r *queryResolver) MyCars(ctx context.Context, status *models.CarStatus, page *int, limit *int) (*models.CarsResponse, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, l := pagination(page, limit)
+
+	response, err := r.CarService.GetSellerCars(ctx, user.ID, status, p, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return toCarsResponse(response), nil
+}
+
+// MyDrafts is the resolver for the myDrafts field.
+func (r *queryResolver) MyDrafts(ctx context.Context, page *int, limit *int) (*models.CarsResponse, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, l := pagination(page, limit)
+	status := models.CarStatusDraft
+
+	response, err := r.CarService.GetSellerCars(ctx, user.ID, &status, p, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return toCarsResponse(response), nil
 }
 
 // MyCart is the resolver for the myCart field.
 func (r *queryResolver) MyCart(ctx context.Context) (*models.Cart, error) {
-	panic(fmt.Errorf("not implemented: MyCart - myCart"))
+	return r.CartService.GetCart(ctx, cartOwner(ctx))
 }
 
 // Health is the resolver for the health field.
@@ -241,6 +556,15 @@ func (r *queryResolver) Health(ctx context.Context) (string, error) {
 	return "GraphQL API is healthy!", nil
 }
 
+// Actor is the resolver for the actor field.
+func (r *statusChangeResolver) Actor(ctx context.Context, obj *models.StatusChange) (*models.User, error) {
+	if obj.ActorID == nil {
+		return nil, nil
+	}
+
+	return loaders.GetUser(ctx, *obj.ActorID)
+}
+
 // ID is the resolver for the id field.
 func (r *userResolver) ID(ctx context.Context, obj *models.User) (string, error) {
 	return obj.ID.Hex(), nil
@@ -249,6 +573,9 @@ func (r *userResolver) ID(ctx context.Context, obj *models.User) (string, error)
 // Car returns generated.CarResolver implementation.
 func (r *Resolver) Car() generated.CarResolver { return &carResolver{r} }
 
+// CarImage returns generated.CarImageResolver implementation.
+func (r *Resolver) CarImage() generated.CarImageResolver { return &carImageResolver{r} }
+
 // Cart returns generated.CartResolver implementation.
 func (r *Resolver) Cart() generated.CartResolver { return &cartResolver{r} }
 
@@ -261,12 +588,17 @@ func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResol
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// StatusChange returns generated.StatusChangeResolver implementation.
+func (r *Resolver) StatusChange() generated.StatusChangeResolver { return &statusChangeResolver{r} }
+
 // User returns generated.UserResolver implementation.
 func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
 
 type carResolver struct{ *Resolver }
+type carImageResolver struct{ *Resolver }
 type cartResolver struct{ *Resolver }
 type cartItemResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type statusChangeResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
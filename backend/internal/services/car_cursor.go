@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the requested sort
+var ErrInvalidCursor = apperrors.BadUserInput("invalid cursor")
+
+// carCursor is the position of a car in a sorted listing. Cursors are opaque
+// to clients, they are base64 encoded JSON of the sort key and the _id.
+type carCursor struct {
+	Field models.CarSortField `json:"f"`
+	Value json.RawMessage     `json:"v"`
+	ID    primitive.ObjectID  `json:"id"`
+}
+
+// encodeCarCursor returns the cursor of a car in a listing sorted by field
+func encodeCarCursor(field models.CarSortField, car *models.Car) (string, error) {
+	value, err := json.Marshal(carSortValue(field, car))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(carCursor{Field: field, Value: value, ID: car.ID})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCarCursor returns the sort value and _id stored in a cursor, checking
+// that it was issued for a listing sorted by field
+func decodeCarCursor(field models.CarSortField, encoded string) (interface{}, primitive.ObjectID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	var cursor carCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Field != field || cursor.ID.IsZero() {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	var value interface{}
+	switch field {
+	case models.CarSortFieldPrice, models.CarSortFieldDistance:
+		var number float64
+		err = json.Unmarshal(cursor.Value, &number)
+		value = number
+	case models.CarSortFieldYear, models.CarSortFieldMileage:
+		var number int
+		err = json.Unmarshal(cursor.Value, &number)
+		value = number
+	case models.CarSortFieldCreatedAt:
+		var createdAt time.Time
+		err = json.Unmarshal(cursor.Value, &createdAt)
+		value = createdAt
+	default:
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	return value, cursor.ID, nil
+}
+
+// carSortValue returns the value a car is sorted by
+func carSortValue(field models.CarSortField, car *models.Car) interface{} {
+	switch field {
+	case models.CarSortFieldPrice:
+		return car.Price
+	case models.CarSortFieldYear:
+		return car.Year
+	case models.CarSortFieldMileage:
+		return car.Mileage
+	case models.CarSortFieldDistance:
+		if car.DistanceKm == nil {
+			return 0.0
+		}
+		return *car.DistanceKm
+	default:
+		return car.CreatedAt
+	}
+}
+
+// keysetCondition matches the documents that come after the given position
+// when sorting by key and then _id in direction (1 or -1)
+func keysetCondition(key string, direction int, value interface{}, id primitive.ObjectID) bson.M {
+	operator := "$gt"
+	if direction < 0 {
+		operator = "$lt"
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{key: bson.M{operator: value}},
+		bson.M{key: value, "_id": bson.M{operator: id}},
+	}}
+}
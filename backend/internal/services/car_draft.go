@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// ErrNotDraft is returned when saving a draft over a listing that was already published
+var ErrNotDraft = apperrors.BadUserInput("only drafts can be saved, use updateCar for published listings")
+
+// firstModelYear is the year of the first production car
+const firstModelYear = 1886
+
+// maxModelYear is the latest valid model year, cars of the next model year
+// are sold before the year starts
+func maxModelYear() int {
+	return time.Now().Year() + 1
+}
+
+// SaveCarDraft creates a draft listing for the actor, or updates one of
+// their drafts when an ID is given. Drafts can be incomplete, they are only
+// validated when published.
+func (s *CarService) SaveCarDraft(ctx context.Context, actor *models.User, input *UpdateCarInput) (*models.Car, error) {
+	now := time.Now()
+
+	if input.ID != "" {
+		car, err := s.getCarForUpdate(ctx, actor, input.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.normalizeNames(ctx, input, car); err != nil {
+			return nil, err
+		}
+		fields, err := carFieldUpdates(input, car)
+		if err != nil {
+			return nil, err
+		}
+		fields["updatedAt"] = now
+
+		result, err := s.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": car.ID, "status": models.CarStatusDraft},
+			bson.M{"$set": fields},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save draft: %v", err)
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrNotDraft
+		}
+		s.deleteRemovedImages(ctx, car, fields)
+
+		return s.GetCarByID(ctx, input.ID)
+	}
+
+	if err := s.normalizeNames(ctx, input, nil); err != nil {
+		return nil, err
+	}
+	fields, err := carFieldUpdates(input, nil)
+	if err != nil {
+		return nil, err
+	}
+	fields["updatedAt"] = now
+
+	// Create the draft with the provided fields, empty lists for the others
+	id := primitive.NewObjectID()
+	defaults := bson.M{
+		"status":        models.CarStatusDraft,
+		"sellerId":      actor.ID,
+		"images":        []models.CarImage{},
+		"features":      []string{},
+		"statusHistory": []models.StatusChange{newStatusChange(nil, models.CarStatusDraft, actor, now)},
+		"createdAt":     now,
+	}
+	for key := range fields {
+		delete(defaults, key)
+	}
+
+	_, err = s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": fields, "$setOnInsert": defaults},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create draft: %v", err)
+	}
+
+	return s.GetCarByID(ctx, id.Hex())
+}
+
+// GetVisibleCar retrieves a car by its ID, hiding drafts from everyone but
+// their seller and admins
+func (s *CarService) GetVisibleCar(ctx context.Context, viewer *models.User, id string) (*models.Car, error) {
+	car, err := s.GetCarByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if car.Status == models.CarStatusDraft && !car.IsOwnedBy(viewer) && (viewer == nil || viewer.Role != models.UserRoleAdmin) {
+		return nil, ErrCarNotFound
+	}
+
+	return car, nil
+}
+
+// validateListing checks that a car has every field a published listing
+// needs, reporting the invalid fields with the given message
+func validateListing(car *models.Car, message string) error {
+	var fields []apperrors.FieldError
+	invalid := func(field, message string) {
+		fields = append(fields, apperrors.FieldError{Field: field, Message: message})
+	}
+
+	for _, text := range []struct {
+		field string
+		value string
+	}{
+		{"title", car.Title},
+		{"description", car.Description},
+		{"brand", car.Brand},
+		{"model", car.Model},
+		{"color", car.Color},
+		{"location.city", car.Location.City},
+		{"location.state", car.Location.State},
+		{"location.country", car.Location.Country},
+	} {
+		if strings.TrimSpace(text.value) == "" {
+			invalid(text.field, "is required")
+		}
+	}
+
+	if car.Year < firstModelYear || car.Year > maxModelYear() {
+		invalid("year", fmt.Sprintf("must be between %d and %d", firstModelYear, maxModelYear()))
+	}
+	if car.Price <= 0 {
+		invalid("price", "must be greater than 0")
+	}
+	if car.Mileage < 0 {
+		invalid("mileage", "must not be negative")
+	}
+	if car.VIN != nil {
+		if message := checkVIN(*car.VIN, car.Year); message != "" {
+			invalid("vin", message)
+		}
+	}
+
+	switch car.FuelType {
+	case models.FuelTypeGasoline, models.FuelTypeDiesel, models.FuelTypeElectric, models.FuelTypeHybrid:
+	default:
+		invalid("fuelType", "is required")
+	}
+	switch car.Transmission {
+	case models.TransmissionTypeManual, models.TransmissionTypeAutomatic:
+	default:
+		invalid("transmission", "is required")
+	}
+
+	if len(fields) > 0 {
+		return apperrors.InvalidFields(message, fields)
+	}
+	return nil
+}
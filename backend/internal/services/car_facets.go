@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// priceBoundaries are the lower bounds of the price buckets, the last one is open ended
+var priceBoundaries = []float64{0, 5000, 10000, 20000, 30000, 50000, 75000, 100000}
+
+// facetCount is a group of the facet aggregation
+type facetCount struct {
+	Value interface{} `bson:"_id"`
+	Count int         `bson:"count"`
+}
+
+// GetCarFacets counts the available cars matching the filter by brand, fuel
+// type, transmission, year and price in a single aggregation. Every facet
+// applies all filters except the one on its own field, so picking a brand
+// still shows the counts of the other brands.
+func (s *CarService) GetCarFacets(ctx context.Context, filter *CarFilterInput) (*models.CarFacets, error) {
+	query, err := s.carFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	query.filter["status"] = string(models.CarStatusAvailable)
+
+	byCount := bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}
+	newestFirst := bson.D{{Key: "_id", Value: -1}}
+
+	pipeline := bson.A{
+		bson.M{"$match": withoutFacetClauses(query.filter)},
+		bson.M{"$facet": bson.M{
+			"brands":        countBy(query.filter, brandSearchKey, "brand", byCount),
+			"fuelTypes":     countBy(query.filter, "fuelType", "fuelType", byCount),
+			"transmissions": countBy(query.filter, "transmission", "transmission", byCount),
+			"years":         countBy(query.filter, "year", "year", newestFirst),
+			"prices": bson.A{
+				bson.M{"$match": facetClauses(query.filter, "price")},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price",
+					"boundaries": priceBoundaries,
+					"default":    priceBoundaries[len(priceBoundaries)-1],
+				}},
+			},
+		}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate car facets: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Brands        []facetCount `bson:"brands"`
+		FuelTypes     []facetCount `bson:"fuelTypes"`
+		Transmissions []facetCount `bson:"transmissions"`
+		Years         []facetCount `bson:"years"`
+		Prices        []facetCount `bson:"prices"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode car facets: %v", err)
+	}
+
+	facets := &models.CarFacets{
+		Brands:        []*models.FacetCount{},
+		FuelTypes:     []*models.FacetCount{},
+		Transmissions: []*models.FacetCount{},
+		Years:         []*models.FacetCount{},
+		Prices:        []*models.PriceBucket{},
+	}
+	if len(results) == 0 {
+		return facets, nil
+	}
+
+	result := results[0]
+	facets.Brands = toFacetCounts(result.Brands)
+	facets.FuelTypes = toFacetCounts(result.FuelTypes)
+	facets.Transmissions = toFacetCounts(result.Transmissions)
+	facets.Years = toFacetCounts(result.Years)
+	facets.Prices = toPriceBuckets(result.Prices)
+
+	return facets, nil
+}
+
+// carFacetKeys are the filter clauses that have a facet of their own
+var carFacetKeys = []string{brandSearchKey, "fuelType", "transmission", "year", "price"}
+
+// withoutFacetClauses returns the filter clauses shared by every facet
+func withoutFacetClauses(filter bson.M) bson.M {
+	shared := bson.M{}
+	for key, value := range filter {
+		shared[key] = value
+	}
+	for _, key := range carFacetKeys {
+		delete(shared, key)
+	}
+	return shared
+}
+
+// facetClauses returns the facet filter clauses except the one on key
+func facetClauses(filter bson.M, key string) bson.M {
+	clauses := bson.M{}
+	for _, facetKey := range carFacetKeys {
+		if value, ok := filter[facetKey]; ok && facetKey != key {
+			clauses[facetKey] = value
+		}
+	}
+	return clauses
+}
+
+// countBy returns a facet pipeline counting the cars per value of field,
+// applying the facet clauses except the one on key
+func countBy(filter bson.M, key, field string, sort bson.D) bson.A {
+	return bson.A{
+		bson.M{"$match": facetClauses(filter, key)},
+		bson.M{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": sort},
+	}
+}
+
+// toFacetCounts converts aggregation groups to facet counts
+func toFacetCounts(groups []facetCount) []*models.FacetCount {
+	counts := make([]*models.FacetCount, 0, len(groups))
+	for _, group := range groups {
+		if group.Value == nil {
+			continue // Listings missing the field
+		}
+		counts = append(counts, &models.FacetCount{Value: fmt.Sprint(group.Value), Count: group.Count})
+	}
+	return counts
+}
+
+// toPriceBuckets converts $bucket groups, keyed by their lower bound, to price buckets
+func toPriceBuckets(groups []facetCount) []*models.PriceBucket {
+	buckets := make([]*models.PriceBucket, 0, len(groups))
+	for _, group := range groups {
+		min, ok := group.Value.(float64)
+		if !ok {
+			continue
+		}
+
+		bucket := &models.PriceBucket{Min: min, Count: group.Count}
+		for i, boundary := range priceBoundaries[:len(priceBoundaries)-1] {
+			if boundary == min {
+				max := priceBoundaries[i+1]
+				bucket.Max = &max
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// validateCarFilter checks the ranges of a filter and reports every invalid field
+func validateCarFilter(filter *CarFilterInput) error {
+	var fields []apperrors.FieldError
+	invalid := func(field, message string) {
+		fields = append(fields, apperrors.FieldError{Field: field, Message: message})
+	}
+
+	maxYear := maxModelYear()
+
+	for _, year := range []struct {
+		field string
+		value *int
+	}{{"minYear", filter.MinYear}, {"maxYear", filter.MaxYear}} {
+		if year.value == nil {
+			continue
+		}
+		if *year.value < 0 {
+			invalid(year.field, "must not be negative")
+		} else if *year.value > maxYear {
+			invalid(year.field, fmt.Sprintf("must not be after %d", maxYear))
+		}
+	}
+
+	for _, price := range []struct {
+		field string
+		value *float64
+	}{{"minPrice", filter.MinPrice}, {"maxPrice", filter.MaxPrice}} {
+		if price.value != nil && *price.value < 0 {
+			invalid(price.field, "must not be negative")
+		}
+	}
+
+	for _, mileage := range []struct {
+		field string
+		value *int
+	}{{"minMileage", filter.MinMileage}, {"maxMileage", filter.MaxMileage}} {
+		if mileage.value != nil && *mileage.value < 0 {
+			invalid(mileage.field, "must not be negative")
+		}
+	}
+
+	if filter.MinYear != nil && filter.MaxYear != nil && *filter.MinYear > *filter.MaxYear {
+		invalid("minYear", "must not be greater than maxYear")
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		invalid("minPrice", "must not be greater than maxPrice")
+	}
+	if filter.MinMileage != nil && filter.MaxMileage != nil && *filter.MinMileage > *filter.MaxMileage {
+		invalid("minMileage", "must not be greater than maxMileage")
+	}
+
+	for _, text := range []struct {
+		field string
+		value *string
+	}{{"brand", filter.Brand}, {"model", filter.Model}, {"city", filter.City}, {"state", filter.State}} {
+		if text.value != nil && len(*text.value) > maxTextFilterLength {
+			invalid(text.field, fmt.Sprintf("must be at most %d characters long", maxTextFilterLength))
+		}
+	}
+
+	if filter.SellerID != nil && !primitive.IsValidObjectID(*filter.SellerID) {
+		invalid("sellerId", "is not a valid ID")
+	}
+
+	if near := filter.Near; near != nil {
+		if !validCoordinates(near.Lat, near.Lng) {
+			invalid("near", "latitude must be between -90 and 90 and longitude between -180 and 180")
+		}
+		if near.RadiusKm <= 0 || near.RadiusKm > maxNearRadiusKm {
+			invalid("near.radiusKm", fmt.Sprintf("must be greater than 0 and at most %g", maxNearRadiusKm))
+		}
+	}
+
+	if len(fields) > 0 {
+		return apperrors.InvalidFields("invalid car filter", fields)
+	}
+	return nil
+}
+
+// maxTextFilterLength bounds the free text filter values sent to the database
+const maxTextFilterLength = 100
+
+// notDeleted returns a filter excluding soft deleted cars
+func notDeleted() bson.M {
+	return bson.M{"deletedAt": nil}
+}
+
+// caseInsensitive compares strings ignoring case
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// Search keys of the free text filters
+const (
+	brandSearchKey = "searchKeys.brand"
+	modelSearchKey = "searchKeys.model"
+	citySearchKey  = "searchKeys.city"
+	stateSearchKey = "searchKeys.state"
+)
+
+// searchKey is the form free text is matched in, lowercased with single spaces
+func searchKey(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
+
+// carSearchKeys returns the search keys of a car
+func carSearchKeys(car *models.Car) models.CarSearchKeys {
+	return models.CarSearchKeys{
+		Brand: searchKey(car.Brand),
+		Model: searchKey(car.Model),
+		City:  searchKey(car.Location.City),
+		State: searchKey(car.Location.State),
+	}
+}
+
+// searchKeysBatchSize is the number of cars updated per write by MigrateSearchKeys
+const searchKeysBatchSize = 500
+
+// MigrateSearchKeys adds the search keys to listings created before they
+// existed. The keys are computed here rather than in the database, so that
+// they are lowercased exactly like filter input.
+func (s *CarService) MigrateSearchKeys(ctx context.Context) (int, error) {
+	findOptions := options.Find().SetProjection(bson.M{"brand": 1, "model": 1, "location": 1})
+	cursor, err := s.collection.Find(ctx, bson.M{"searchKeys": bson.M{"$exists": false}}, findOptions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find cars without search keys: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		result, err := s.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return fmt.Errorf("failed to migrate search keys: %v", err)
+		}
+		migrated += int(result.ModifiedCount)
+		writes = writes[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var car models.Car
+		if err := cursor.Decode(&car); err != nil {
+			return migrated, fmt.Errorf("failed to decode car: %v", err)
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": car.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"searchKeys": carSearchKeys(&car)}}))
+
+		if len(writes) == searchKeysBatchSize {
+			if err := flush(); err != nil {
+				return migrated, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return migrated, fmt.Errorf("failed to read cars: %v", err)
+	}
+
+	return migrated, flush()
+}
+
+// carQuery is a MongoDB filter together with the sort it must run with
+type carQuery struct {
+	filter bson.M
+	sort   bson.D
+	// near is set when searching around a point, the cars are then read
+	// through $geoNear and distanceFilter applies to their distance
+	near           *NearInput
+	distanceFilter bson.M
+}
+
+// buildCarFilter validates the filter input and converts it into a MongoDB filter
+func buildCarFilter(filter *CarFilterInput) (*carQuery, error) {
+	query := &carQuery{filter: notDeleted()}
+	if filter == nil {
+		return query, nil
+	}
+
+	if err := validateCarFilter(filter); err != nil {
+		return nil, err
+	}
+
+	mode := models.TextMatchModePrefix
+	if filter.MatchMode != nil {
+		mode = *filter.MatchMode
+	}
+
+	mongoFilter := query.filter
+	if filter.Brand != nil {
+		mongoFilter[brandSearchKey] = textCondition(*filter.Brand, mode)
+	}
+	if filter.Model != nil {
+		mongoFilter[modelSearchKey] = textCondition(*filter.Model, mode)
+	}
+	if r := numberRange(filter.MinYear, filter.MaxYear); r != nil {
+		mongoFilter["year"] = r
+	}
+	if r := numberRange(filter.MinPrice, filter.MaxPrice); r != nil {
+		mongoFilter["price"] = r
+	}
+	if r := numberRange(filter.MinMileage, filter.MaxMileage); r != nil {
+		mongoFilter["mileage"] = r
+	}
+	if filter.FuelType != nil {
+		mongoFilter["fuelType"] = string(*filter.FuelType)
+	}
+	if filter.Transmission != nil {
+		mongoFilter["transmission"] = string(*filter.Transmission)
+	}
+	if filter.City != nil {
+		mongoFilter[citySearchKey] = textCondition(*filter.City, mode)
+	}
+	if filter.State != nil {
+		mongoFilter[stateSearchKey] = textCondition(*filter.State, mode)
+	}
+	if filter.SellerID != nil {
+		sellerID, _ := primitive.ObjectIDFromHex(*filter.SellerID)
+		mongoFilter["sellerId"] = sellerID
+	}
+	if filter.Near != nil {
+		query.near = filter.Near
+		mongoFilter[nearKey] = withinRadius(filter.Near)
+	}
+
+	return query, nil
+}
+
+// textCondition builds the condition on the search key of a free text field.
+// Keys and input are lowercased, so the expressions are case-sensitive and
+// user input is always escaped, it can never be interpreted as a regular
+// expression.
+//
+//	EXACT  whole value, an equality on the index
+//	PREFIX value starting with the input, anchored so only the matching index range is scanned
+//	FUZZY  value containing the input anywhere, opt-in as it scans every index key
+func textCondition(value string, mode models.TextMatchMode) interface{} {
+	key := searchKey(value)
+
+	switch mode {
+	case models.TextMatchModeExact:
+		return key
+	case models.TextMatchModeFuzzy:
+		return primitive.Regex{Pattern: regexp.QuoteMeta(key)}
+	default:
+		return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(key)}
+	}
+}
+
+// numberRange builds a $gte/$lte condition, or nil when both bounds are missing
+func numberRange[T int | float64](min, max *T) bson.M {
+	if min == nil && max == nil {
+		return nil
+	}
+
+	condition := bson.M{}
+	if min != nil {
+		condition["$gte"] = *min
+	}
+	if max != nil {
+		condition["$lte"] = *max
+	}
+	return condition
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+const (
+	// earthRadiusKm converts distances to the radians used by $centerSphere
+	earthRadiusKm = 6378.1
+	// maxNearRadiusKm bounds the radius of a near filter
+	maxNearRadiusKm = 1000.0
+	// nearKey is the indexed GeoJSON point of a listing
+	nearKey = "location.point"
+)
+
+// validCoordinates reports whether lat and lng are a valid position
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// newLocation converts a location input, adding the GeoJSON point when both
+// coordinates are given
+func newLocation(input LocationInput) (models.Location, error) {
+	location := models.Location{
+		City:    input.City,
+		State:   input.State,
+		Country: input.Country,
+		Lat:     input.Lat,
+		Lng:     input.Lng,
+	}
+
+	if input.Lat != nil && input.Lng != nil {
+		if !validCoordinates(*input.Lat, *input.Lng) {
+			return location, apperrors.InvalidFields("invalid location", []apperrors.FieldError{{
+				Field:   "location",
+				Message: "latitude must be between -90 and 90 and longitude between -180 and 180",
+			}})
+		}
+		location.Point = models.NewGeoPoint(*input.Lat, *input.Lng)
+	}
+
+	return location, nil
+}
+
+// withinRadius matches the listings within the radius of a near filter. It is
+// used wherever $geoNear cannot run, such as counts and facets.
+func withinRadius(near *NearInput) bson.M {
+	return bson.M{"$geoWithin": bson.M{
+		"$centerSphere": bson.A{bson.A{near.Lng, near.Lat}, near.RadiusKm / earthRadiusKm},
+	}}
+}
+
+// geoNearStage returns the $geoNear stage of a query around a point, which
+// sets distanceKm on every car
+func geoNearStage(query *carQuery) bson.M {
+	filter := bson.M{}
+	for key, value := range query.filter {
+		if key != nearKey {
+			filter[key] = value // The radius is applied by maxDistance
+		}
+	}
+
+	return bson.M{"$geoNear": bson.M{
+		"near":               models.NewGeoPoint(query.near.Lat, query.near.Lng),
+		"key":                nearKey,
+		"distanceField":      "distanceKm",
+		"distanceMultiplier": 0.001,
+		"maxDistance":        query.near.RadiusKm * 1000,
+		"spherical":          true,
+		"query":              filter,
+	}}
+}
+
+// MigrateLocationPoints adds the GeoJSON point to listings that only have
+// lat/lng, so that they can be found by near filters
+func (s *CarService) MigrateLocationPoints(ctx context.Context) (int, error) {
+	result, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{
+			"location.point": bson.M{"$exists": false},
+			"location.lat":   bson.M{"$gte": -90, "$lte": 90},
+			"location.lng":   bson.M{"$gte": -180, "$lte": 180},
+		},
+		bson.A{bson.M{"$set": bson.M{
+			"location.point": bson.M{
+				"type":        "Point",
+				"coordinates": bson.A{"$location.lng", "$location.lat"},
+			},
+		}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate car locations: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// imagesFromURLs converts the image URLs of a car input into images. Existing
+// images listed by their URL are kept with their variants, the first image is
+// the cover.
+func imagesFromURLs(urls []string, existing []models.CarImage) []models.CarImage {
+	byURL := make(map[string]models.CarImage, len(existing))
+	for _, image := range existing {
+		if variant := image.Variant(models.ImageSizeFull); variant != nil {
+			byURL[variant.URL] = image
+		}
+	}
+
+	images := make([]models.CarImage, 0, len(urls))
+	for i, url := range urls {
+		image, ok := byURL[url]
+		if !ok {
+			image = models.CarImage{
+				ID:       primitive.NewObjectID().Hex(),
+				Variants: []models.ImageVariant{{Size: models.ImageSizeFull, URL: url}},
+			}
+		}
+		image.IsCover = i == 0
+		images = append(images, image)
+	}
+
+	return images
+}
+
+// deleteRemovedImages deletes the stored variants of the images of a car that
+// an update replacing its images no longer lists
+func (s *CarService) deleteRemovedImages(ctx context.Context, car *models.Car, fields bson.M) {
+	images, ok := fields["images"].([]models.CarImage)
+	if !ok || s.deleteImages == nil {
+		return
+	}
+
+	kept := make(map[string]bool, len(images))
+	for _, image := range images {
+		kept[image.ID] = true
+	}
+	var removed []models.CarImage
+	for _, image := range car.Images {
+		if !kept[image.ID] {
+			removed = append(removed, image)
+		}
+	}
+	s.deleteImages(ctx, removed...)
+}
+
+// MigrateImages converts the image URLs stored by older listings into images
+// with a single FULL variant. The first image becomes the cover.
+func (s *CarService) MigrateImages(ctx context.Context) (int, error) {
+	result, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"images": bson.M{"$type": "string"}},
+		bson.A{bson.M{"$set": bson.M{
+			"images": bson.M{"$map": bson.M{
+				"input": bson.M{"$range": bson.A{0, bson.M{"$size": "$images"}}},
+				"as":    "index",
+				"in": bson.M{"$let": bson.M{
+					"vars": bson.M{"image": bson.M{"$arrayElemAt": bson.A{"$images", "$$index"}}},
+					"in": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{bson.M{"$type": "$$image"}, "string"}},
+						bson.M{
+							"_id":      bson.M{"$concat": bson.A{"legacy-", bson.M{"$toString": "$$index"}}},
+							"variants": bson.A{bson.M{"size": models.ImageSizeFull, "url": "$$image"}},
+							"isCover":  bson.M{"$eq": bson.A{"$$index", 0}},
+						},
+						"$$image",
+					}},
+				}},
+			}},
+		}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate car images: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"strings"
 	"time"
 
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
 	"github.com/limosnd/marketplace-go-graphql/internal/database"
 	"github.com/limosnd/marketplace-go-graphql/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,88 +17,99 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	// ErrCarNotFound is returned when no car exists with the requested ID
+	ErrCarNotFound = apperrors.NotFound("car not found")
+	// ErrNotCarOwner is returned when a user tries to modify a listing they do not own
+	ErrNotCarOwner = apperrors.Forbidden("only the seller or an admin can modify this car")
+)
+
+// DefaultListingLifetime is how long a published listing stays available before it expires
+const DefaultListingLifetime = 60 * 24 * time.Hour
+
 type CarService struct {
 	collection *mongo.Collection
+	catalog    *CatalogService
+	// ListingLifetime is how long listings stay available once published or renewed
+	ListingLifetime time.Duration
+	// deleteImages removes the stored variants of images dropped from a car,
+	// it is set by the image service
+	deleteImages func(ctx context.Context, images ...models.CarImage)
 }
 
 // NewCarService creates a new car service
 func NewCarService() *CarService {
 	return &CarService{
-		collection: database.GetCollection("cars"),
+		collection:      database.GetCollection("cars"),
+		catalog:         NewCatalogService(),
+		ListingLifetime: DefaultListingLifetime,
 	}
 }
 
-// GetCars retrieves cars with pagination and filtering
-func (s *CarService) GetCars(ctx context.Context, filter *CarFilterInput, page, limit int) (*CarsResponse, error) {
-	// Build MongoDB filter
-	mongoFilter := bson.M{}
-	
-	if filter != nil {
-		if filter.Brand != nil {
-			mongoFilter["brand"] = bson.M{"$regex": primitive.Regex{Pattern: *filter.Brand, Options: "i"}}
-		}
-		if filter.Model != nil {
-			mongoFilter["model"] = bson.M{"$regex": primitive.Regex{Pattern: *filter.Model, Options: "i"}}
-		}
-		if filter.MinYear != nil {
-			mongoFilter["year"] = bson.M{"$gte": *filter.MinYear}
-		}
-		if filter.MaxYear != nil {
-			if mongoFilter["year"] == nil {
-				mongoFilter["year"] = bson.M{}
-			}
-			mongoFilter["year"].(bson.M)["$lte"] = *filter.MaxYear
-		}
-		if filter.MinPrice != nil {
-			mongoFilter["price"] = bson.M{"$gte": *filter.MinPrice}
-		}
-		if filter.MaxPrice != nil {
-			if mongoFilter["price"] == nil {
-				mongoFilter["price"] = bson.M{}
-			}
-			mongoFilter["price"].(bson.M)["$lte"] = *filter.MaxPrice
-		}
-		if filter.FuelType != nil {
-			mongoFilter["fuelType"] = string(*filter.FuelType)
-		}
-		if filter.Transmission != nil {
-			mongoFilter["transmission"] = string(*filter.Transmission)
-		}
-		if filter.City != nil {
-			mongoFilter["location.city"] = bson.M{"$regex": primitive.Regex{Pattern: *filter.City, Options: "i"}}
-		}
-		if filter.State != nil {
-			mongoFilter["location.state"] = bson.M{"$regex": primitive.Regex{Pattern: *filter.State, Options: "i"}}
-		}
+// GetCars retrieves cars with pagination, filtering and sorting
+func (s *CarService) GetCars(ctx context.Context, filter *CarFilterInput, sort *CarSortInput, page, limit int) (*CarsResponse, error) {
+	query, err := s.carFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query.sort, err = buildCarSort(sort, false, query.near != nil)
+	if err != nil {
+		return nil, err
 	}
 
 	// Only show available cars by default
-	mongoFilter["status"] = string(models.CarStatusAvailable)
+	query.filter["status"] = string(models.CarStatusAvailable)
+
+	return s.listCars(ctx, query, page, limit)
+}
+
+// GetSellerCars retrieves the cars listed by a seller in any status, or only in the given one
+func (s *CarService) GetSellerCars(ctx context.Context, sellerID primitive.ObjectID, status *models.CarStatus, page, limit int) (*CarsResponse, error) {
+	mongoFilter := notDeleted()
+	mongoFilter["sellerId"] = sellerID
+	if status != nil {
+		mongoFilter["status"] = string(*status)
+	}
+
+	newestFirst, _ := buildCarSort(nil, false, false)
+	return s.listCars(ctx, &carQuery{filter: mongoFilter, sort: newestFirst}, page, limit)
+}
+
+// maxPageLimit bounds the number of cars of a page
+const maxPageLimit = 100
+
+// checkPage returns a BAD_USER_INPUT error for pages before the first one and
+// limits outside 1 to maxPageLimit
+func checkPage(page, limit int) error {
+	if page < 1 {
+		return apperrors.BadUserInput("page must be at least 1")
+	}
+	if limit < 1 || limit > maxPageLimit {
+		return apperrors.BadUserInput(fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+	}
+	return nil
+}
+
+// listCars returns a page of cars matching the query
+func (s *CarService) listCars(ctx context.Context, query *carQuery, page, limit int) (*CarsResponse, error) {
+	if err := checkPage(page, limit); err != nil {
+		return nil, err
+	}
 
 	// Calculate skip
 	skip := (page - 1) * limit
 
 	// Get total count
-	total, err := s.collection.CountDocuments(ctx, mongoFilter)
+	total, err := s.collection.CountDocuments(ctx, query.filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count cars: %v", err)
 	}
 
 	// Find cars with pagination
-	findOptions := options.Find()
-	findOptions.SetSkip(int64(skip))
-	findOptions.SetLimit(int64(limit))
-	findOptions.SetSort(bson.D{{Key: "createdAt", Value: -1}}) // Sort by newest first
-
-	cursor, err := s.collection.Find(ctx, mongoFilter, findOptions)
+	cars, err := s.findCars(ctx, query, skip, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find cars: %v", err)
-	}
-	defer cursor.Close(ctx)
-
-	var cars []*models.Car
-	if err = cursor.All(ctx, &cars); err != nil {
-		return nil, fmt.Errorf("failed to decode cars: %v", err)
+		return nil, err
 	}
 
 	// Calculate total pages
@@ -111,18 +124,152 @@ func (s *CarService) GetCars(ctx context.Context, filter *CarFilterInput, page,
 	}, nil
 }
 
-// GetCarByID retrieves a car by its ID
+// GetCarsConnection retrieves available cars using keyset pagination. Pages
+// are positioned after or before a cursor instead of skipping documents, so
+// they are not shifted by listings created in the meantime.
+func (s *CarService) GetCarsConnection(ctx context.Context, filter *CarFilterInput, sort *CarSortInput, args ConnectionArgs) (*CarConnection, error) {
+	size, backward, err := args.pageSize()
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := s.carFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	query.filter["status"] = string(models.CarStatusAvailable)
+
+	if sort == nil {
+		sort = defaultCarSort(false, query.near != nil)
+	}
+	sortDocument, err := buildCarSort(sort, false, query.near != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Narrow the listing down to the range between the cursors
+	key, direction := sortDocument[0].Key, sortDocument[0].Value.(int)
+	var conditions bson.A
+	if args.After != nil {
+		value, id, err := decodeCarCursor(sort.Field, *args.After)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, keysetCondition(key, direction, value, id))
+	}
+	if args.Before != nil {
+		value, id, err := decodeCarCursor(sort.Field, *args.Before)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, keysetCondition(key, -direction, value, id))
+	}
+	if len(conditions) > 0 {
+		// Distances only exist once $geoNear computed them
+		if sort.Field == models.CarSortFieldDistance {
+			query.distanceFilter = bson.M{"$and": conditions}
+		} else {
+			query.filter["$and"] = conditions
+		}
+	}
+
+	// The last cars are read in reverse order from the end of the range
+	query.sort = sortDocument
+	if backward {
+		query.sort = bson.D{{Key: key, Value: -direction}, {Key: "_id", Value: -direction}}
+	}
+
+	// Fetch one extra car to know whether there are more
+	cars, err := s.findCars(ctx, query, 0, size+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(cars) > size
+	if hasMore {
+		cars = cars[:size]
+	}
+	if backward {
+		for i, j := 0, len(cars)-1; i < j; i, j = i+1, j-1 {
+			cars[i], cars[j] = cars[j], cars[i]
+		}
+	}
+
+	connection := &CarConnection{Edges: make([]CarEdge, 0, len(cars))}
+	for _, car := range cars {
+		cursor, err := encodeCarCursor(sort.Field, car)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %v", err)
+		}
+		connection.Edges = append(connection.Edges, CarEdge{Cursor: cursor, Node: car})
+	}
+
+	// Cars on the other side of the cursor are not counted, a cursor means
+	// the client came from there
+	if backward {
+		connection.HasPreviousPage = hasMore
+		connection.HasNextPage = args.Before != nil
+	} else {
+		connection.HasNextPage = hasMore
+		connection.HasPreviousPage = args.After != nil
+	}
+
+	return connection, nil
+}
+
+// findCars returns the cars matching the query. Queries around a point run as
+// a $geoNear aggregation so that every car carries its distance.
+func (s *CarService) findCars(ctx context.Context, query *carQuery, skip, limit int) ([]*models.Car, error) {
+	var cursor *mongo.Cursor
+	var err error
+
+	if query.near != nil {
+		pipeline := bson.A{geoNearStage(query)}
+		if query.distanceFilter != nil {
+			pipeline = append(pipeline, bson.M{"$match": query.distanceFilter})
+		}
+		pipeline = append(pipeline,
+			bson.M{"$sort": query.sort},
+			bson.M{"$skip": skip},
+			bson.M{"$limit": limit},
+		)
+
+		cursor, err = s.collection.Aggregate(ctx, pipeline)
+	} else {
+		findOptions := options.Find()
+		findOptions.SetSkip(int64(skip))
+		findOptions.SetLimit(int64(limit))
+		findOptions.SetSort(query.sort)
+		cursor, err = s.collection.Find(ctx, query.filter, findOptions)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cars: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var cars []*models.Car
+	if err = cursor.All(ctx, &cars); err != nil {
+		return nil, fmt.Errorf("failed to decode cars: %v", err)
+	}
+
+	return cars, nil
+}
+
+// GetCarByID retrieves a car by its ID, deleted cars are not found
 func (s *CarService) GetCarByID(ctx context.Context, id string) (*models.Car, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, fmt.Errorf("invalid car ID: %v", err)
 	}
 
+	filter := notDeleted()
+	filter["_id"] = objectID
+
 	var car models.Car
-	err = s.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&car)
+	err = s.collection.FindOne(ctx, filter).Decode(&car)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("car not found")
+			return nil, ErrCarNotFound
 		}
 		return nil, fmt.Errorf("failed to find car: %v", err)
 	}
@@ -130,54 +277,104 @@ func (s *CarService) GetCarByID(ctx context.Context, id string) (*models.Car, er
 	return &car, nil
 }
 
-// CreateCar creates a new car
-func (s *CarService) CreateCar(ctx context.Context, input *CarInput) (*models.Car, error) {
-	now := time.Now()
+// GetCarsByIDs retrieves the cars with the given IDs in a single query, keyed
+// by ID. Deleted cars are included so that carts can still show them.
+func (s *CarService) GetCarsByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Car, error) {
+	cars := make(map[primitive.ObjectID]*models.Car, len(ids))
+	if len(ids) == 0 {
+		return cars, nil
+	}
 
-	// Create seller user
-	seller := models.User{
-		ID:        primitive.NewObjectID(),
-		Name:      input.SellerName,
-		Email:     input.SellerEmail,
-		Phone:     &input.SellerPhone,
-		Role:      models.UserRoleSeller,
-		CreatedAt: now,
-		UpdatedAt: now,
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find cars: %v", err)
 	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		car := &models.Car{}
+		if err := cursor.Decode(car); err != nil {
+			return nil, fmt.Errorf("failed to decode car: %v", err)
+		}
+		cars[car.ID] = car
+	}
+
+	return cars, cursor.Err()
+}
+
+// getCarForUpdate retrieves a car and checks that the actor is allowed to modify it
+func (s *CarService) getCarForUpdate(ctx context.Context, actor *models.User, id string) (*models.Car, error) {
+	car, err := s.GetCarByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor == nil || (!car.IsOwnedBy(actor) && actor.Role != models.UserRoleAdmin) {
+		return nil, ErrNotCarOwner
+	}
+
+	return car, nil
+}
+
+// CreateCar creates a new car listed by the given seller
+func (s *CarService) CreateCar(ctx context.Context, seller *models.User, input *CarInput) (*models.Car, error) {
+	now := time.Now()
 
 	// Create location
-	location := models.Location{
-		City:    input.Location.City,
-		State:   input.Location.State,
-		Country: input.Location.Country,
-		Lat:     input.Location.Lat,
-		Lng:     input.Location.Lng,
+	location, err := newLocation(input.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	brand, model, err := s.catalog.Normalize(ctx, input.Brand, input.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	var vin *string
+	if input.VIN != nil {
+		vin = normalizeVIN(*input.VIN)
 	}
 
 	// Create car
+	expiresAt := now.Add(s.ListingLifetime)
 	car := models.Car{
 		ID:           primitive.NewObjectID(),
 		Title:        input.Title,
 		Description:  input.Description,
-		Brand:        input.Brand,
-		Model:        input.Model,
+		Brand:        brand,
+		Model:        model,
 		Year:         input.Year,
 		Price:        input.Price,
 		Mileage:      input.Mileage,
 		Color:        input.Color,
 		FuelType:     models.FuelType(input.FuelType),
 		Transmission: models.TransmissionType(input.Transmission),
+		VIN:          vin,
+		ActiveVIN:    activeVIN(vin, models.CarStatusAvailable),
 		Status:       models.CarStatusAvailable,
-		Images:       input.Images,
-		Seller:       seller,
+		Images:       imagesFromURLs(input.Images, nil),
+		SellerID:     seller.ID,
 		Location:     location,
 		Features:     input.Features,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		StatusHistory: []models.StatusChange{
+			newStatusChange(nil, models.CarStatusAvailable, seller, now),
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: &expiresAt,
+	}
+
+	if err := validateListing(&car, "invalid car"); err != nil {
+		return nil, err
 	}
+	car.SearchKeys = carSearchKeys(&car)
 
 	// Insert into database
 	result, err := s.collection.InsertOne(ctx, car)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateVIN
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create car: %v", err)
 	}
@@ -189,101 +386,388 @@ func (s *CarService) CreateCar(ctx context.Context, input *CarInput) (*models.Ca
 	return &car, nil
 }
 
-// UpdateCar updates an existing car
-func (s *CarService) UpdateCar(ctx context.Context, input *UpdateCarInput) (*models.Car, error) {
-	objectID, err := primitive.ObjectIDFromHex(input.ID)
+// UpdateCar updates an existing car owned by the actor
+func (s *CarService) UpdateCar(ctx context.Context, actor *models.User, input *UpdateCarInput) (*models.Car, error) {
+	car, err := s.getCarForUpdate(ctx, actor, input.ID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid car ID: %v", err)
+		return nil, err
 	}
 
 	// Build update document
-	update := bson.M{
-		"$set": bson.M{
-			"updatedAt": time.Now(),
-		},
+	if err := s.normalizeNames(ctx, input, car); err != nil {
+		return nil, err
+	}
+	fields, err := carFieldUpdates(input, car)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	fields["updatedAt"] = now
+	filter := bson.M{"_id": car.ID}
+	update := bson.M{"$set": fields}
+	vin, status := car.VIN, car.Status
+	if input.VIN != nil {
+		vin = normalizeVIN(*input.VIN)
+	}
+
+	if input.Status != nil && *input.Status != car.Status {
+		// Drafts are checked for completeness when published
+		if car.Status == models.CarStatusDraft {
+			return nil, apperrors.BadUserInput("drafts must be published with publishCar")
+		}
+		// Status changes follow the lifecycle, and only apply if the status did not change meanwhile
+		if err := checkTransition(car.Status, *input.Status); err != nil {
+			return nil, err
+		}
+		from := car.Status
+		filter["status"] = from
+		for key, value := range s.statusFields(from, *input.Status, now) {
+			fields[key] = value
+		}
+		update["$push"] = bson.M{"statusHistory": newStatusChange(&from, *input.Status, actor, now)}
+		status = *input.Status
+	}
+	fields["activeVin"] = activeVIN(vin, status)
+
+	// Published listings must stay complete, drafts are checked when published
+	if status != models.CarStatusDraft {
+		updated, err := applyCarUpdate(car, input)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateListing(updated, "invalid car"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Update the car
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateVIN
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update car: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrStatusChanged
+	}
+	s.deleteRemovedImages(ctx, car, fields)
+
+	// Return updated car
+	return s.GetCarByID(ctx, input.ID)
+}
+
+// carFieldUpdates returns the $set document for the listing fields provided in
+// an update of a car, or of a new draft when car is nil. The status and the
+// reserved VIN are handled separately.
+func carFieldUpdates(input *UpdateCarInput, car *models.Car) (bson.M, error) {
+	fields := bson.M{}
+	var existing []models.CarImage
+	vin, year := input.VIN, input.Year
+	if car != nil {
+		existing = car.Images
+		if vin == nil {
+			vin = car.VIN
+		}
+		if year == nil {
+			year = &car.Year
+		}
+	}
+
+	// The VIN must match the year, whichever of them changes
+	if input.VIN != nil || input.Year != nil {
+		if vin != nil {
+			vin = normalizeVIN(*vin)
+		}
+		if vin != nil {
+			modelYear := 0
+			if year != nil {
+				modelYear = *year
+			}
+			if message := checkVIN(*vin, modelYear); message != "" {
+				return nil, invalidVIN(message)
+			}
+		}
+	}
+	if input.VIN != nil {
+		fields["vin"] = vin
 	}
 
 	if input.Title != nil {
-		update["$set"].(bson.M)["title"] = *input.Title
+		fields["title"] = *input.Title
 	}
 	if input.Description != nil {
-		update["$set"].(bson.M)["description"] = *input.Description
+		fields["description"] = *input.Description
 	}
 	if input.Brand != nil {
-		update["$set"].(bson.M)["brand"] = *input.Brand
+		fields["brand"] = *input.Brand
+		fields[brandSearchKey] = searchKey(*input.Brand)
 	}
 	if input.Model != nil {
-		update["$set"].(bson.M)["model"] = *input.Model
+		fields["model"] = *input.Model
+		fields[modelSearchKey] = searchKey(*input.Model)
 	}
 	if input.Year != nil {
-		update["$set"].(bson.M)["year"] = *input.Year
+		fields["year"] = *input.Year
 	}
 	if input.Price != nil {
-		update["$set"].(bson.M)["price"] = *input.Price
+		fields["price"] = *input.Price
 	}
 	if input.Mileage != nil {
-		update["$set"].(bson.M)["mileage"] = *input.Mileage
+		fields["mileage"] = *input.Mileage
 	}
 	if input.Color != nil {
-		update["$set"].(bson.M)["color"] = *input.Color
+		fields["color"] = *input.Color
 	}
 	if input.FuelType != nil {
-		update["$set"].(bson.M)["fuelType"] = string(*input.FuelType)
+		fields["fuelType"] = string(*input.FuelType)
 	}
 	if input.Transmission != nil {
-		update["$set"].(bson.M)["transmission"] = string(*input.Transmission)
-	}
-	if input.Status != nil {
-		update["$set"].(bson.M)["status"] = string(*input.Status)
+		fields["transmission"] = string(*input.Transmission)
 	}
 	if input.Images != nil {
-		update["$set"].(bson.M)["images"] = input.Images
+		fields["images"] = imagesFromURLs(input.Images, existing)
 	}
 	if input.Features != nil {
-		update["$set"].(bson.M)["features"] = input.Features
+		fields["features"] = input.Features
 	}
 	if input.Location != nil {
-		location := models.Location{
-			City:    input.Location.City,
-			State:   input.Location.State,
-			Country: input.Location.Country,
-			Lat:     input.Location.Lat,
-			Lng:     input.Location.Lng,
+		location, err := newLocation(*input.Location)
+		if err != nil {
+			return nil, err
 		}
-		update["$set"].(bson.M)["location"] = location
+		fields["location"] = location
+		fields[citySearchKey] = searchKey(location.City)
+		fields[stateSearchKey] = searchKey(location.State)
 	}
 
-	// Update the car
-	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	return fields, nil
+}
+
+// applyCarUpdate returns a copy of a car with the listing fields of an update applied
+func applyCarUpdate(car *models.Car, input *UpdateCarInput) (*models.Car, error) {
+	updated := *car
+
+	if input.Title != nil {
+		updated.Title = *input.Title
+	}
+	if input.Description != nil {
+		updated.Description = *input.Description
+	}
+	if input.Brand != nil {
+		updated.Brand = *input.Brand
+	}
+	if input.Model != nil {
+		updated.Model = *input.Model
+	}
+	if input.Year != nil {
+		updated.Year = *input.Year
+	}
+	if input.Price != nil {
+		updated.Price = *input.Price
+	}
+	if input.Mileage != nil {
+		updated.Mileage = *input.Mileage
+	}
+	if input.Color != nil {
+		updated.Color = *input.Color
+	}
+	if input.FuelType != nil {
+		updated.FuelType = *input.FuelType
+	}
+	if input.Transmission != nil {
+		updated.Transmission = *input.Transmission
+	}
+	if input.VIN != nil {
+		updated.VIN = normalizeVIN(*input.VIN)
+	}
+	if input.Location != nil {
+		location, err := newLocation(*input.Location)
+		if err != nil {
+			return nil, err
+		}
+		updated.Location = location
+	}
+
+	return &updated, nil
+}
+
+// DeleteCar marks a car owned by the actor as deleted. It disappears from
+// every query but stays in the carts referencing it until it is purged.
+func (s *CarService) DeleteCar(ctx context.Context, actor *models.User, id string) (bool, error) {
+	car, err := s.getCarForUpdate(ctx, actor, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update car: %v", err)
+		return false, err
 	}
 
-	// Return updated car
-	return s.GetCarByID(ctx, input.ID)
+	now := time.Now()
+	filter := notDeleted()
+	filter["_id"] = car.ID
+
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deletedAt": now, "updatedAt": now, "activeVin": nil}})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete car: %v", err)
+	}
+
+	return result.ModifiedCount > 0, nil
 }
 
-// DeleteCar deletes a car by ID
-func (s *CarService) DeleteCar(ctx context.Context, id string) (bool, error) {
+// RestoreCar brings back a deleted car that has not been purged yet
+func (s *CarService) RestoreCar(ctx context.Context, id string) (*models.Car, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return false, fmt.Errorf("invalid car ID: %v", err)
+		return nil, fmt.Errorf("invalid car ID: %v", err)
 	}
 
-	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	// The car reserves its VIN again unless it was sold or never published
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID, "deletedAt": bson.M{"$ne": nil}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"updatedAt": time.Now(),
+				"activeVin": bson.M{"$cond": bson.A{
+					bson.M{"$in": bson.A{"$status", reservingStatuses}},
+					"$vin",
+					nil,
+				}},
+			}}},
+			{{Key: "$unset", Value: "deletedAt"}},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateVIN
+	}
 	if err != nil {
-		return false, fmt.Errorf("failed to delete car: %v", err)
+		return nil, fmt.Errorf("failed to restore car: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrCarNotFound
+	}
+
+	return s.GetCarByID(ctx, id)
+}
+
+// PurgeDeletedCars permanently removes the cars deleted before the given time
+// along with their stored images
+func (s *CarService) PurgeDeletedCars(ctx context.Context, deletedBefore time.Time) (int, error) {
+	filter := bson.M{"deletedAt": bson.M{"$lt": deletedBefore}}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"images": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find deleted cars: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	purged := 0
+	for cursor.Next(ctx) {
+		var car models.Car
+		if err := cursor.Decode(&car); err != nil {
+			return purged, fmt.Errorf("failed to decode deleted car: %v", err)
+		}
+
+		// Cars restored meanwhile are kept with their images
+		filter["_id"] = car.ID
+		result, err := s.collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge deleted car: %v", err)
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		purged++
+		if s.deleteImages != nil {
+			s.deleteImages(ctx, car.Images...)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return purged, fmt.Errorf("failed to purge deleted cars: %v", err)
 	}
 
-	return result.DeletedCount > 0, nil
+	return purged, nil
 }
 
-// SearchCars searches cars by text
-func (s *CarService) SearchCars(ctx context.Context, query string, page, limit int) (*CarsResponse, error) {
+// MigrateEmbeddedSellers replaces the seller documents embedded in older
+// listings with a sellerId reference to a registered account. Sellers without
+// an account get a passwordless one that they can claim with a token issued by an admin.
+func (s *CarService) MigrateEmbeddedSellers(ctx context.Context, users *UserService) (int, error) {
+	// Listings that already have a reference only need the copy removed
+	_, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"sellerId": bson.M{"$exists": true}, "seller": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"seller": ""}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove embedded sellers: %v", err)
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"sellerId":     bson.M{"$exists": false},
+		"seller.email": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find cars to migrate: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			Seller models.User        `bson:"seller"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return migrated, fmt.Errorf("failed to decode car: %v", err)
+		}
+
+		seller, err := users.FindOrCreateSeller(ctx, legacy.Seller.Name, legacy.Seller.Email, legacy.Seller.Phone)
+		if err != nil {
+			return migrated, err
+		}
+
+		_, err = s.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": legacy.ID},
+			bson.M{
+				"$set":   bson.M{"sellerId": seller.ID},
+				"$unset": bson.M{"seller": ""},
+			},
+		)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate car seller: %v", err)
+		}
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
+
+// SearchCars searches available cars by text, optionally narrowed down by a
+// filter, ordered by relevance unless another sort is given. Each car carries
+// its text score.
+func (s *CarService) SearchCars(ctx context.Context, query string, filter *CarFilterInput, sort *CarSortInput, page, limit int) (*CarsResponse, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, apperrors.BadUserInput("search query must not be empty")
+	}
+	if err := checkPage(page, limit); err != nil {
+		return nil, err
+	}
+	if filter != nil && filter.Near != nil {
+		// $text and $geoNear both need to be the first stage of a query
+		return nil, apperrors.BadUserInput("near cannot be combined with a text search")
+	}
+
 	// Build text search filter
-	mongoFilter := bson.M{
-		"$text": bson.M{"$search": query},
-		"status": string(models.CarStatusAvailable),
+	search, err := s.carFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	mongoFilter := search.filter
+	mongoFilter["$text"] = bson.M{"$search": query}
+	mongoFilter["status"] = string(models.CarStatusAvailable)
+
+	sortDocument, err := buildCarSort(sort, true, false)
+	if err != nil {
+		return nil, err
 	}
 
 	// Calculate skip
@@ -295,11 +779,12 @@ func (s *CarService) SearchCars(ctx context.Context, query string, page, limit i
 		return nil, fmt.Errorf("failed to count cars: %v", err)
 	}
 
-	// Find cars with pagination
+	// Find cars with pagination, sorting by relevance requires projecting the score
 	findOptions := options.Find()
 	findOptions.SetSkip(int64(skip))
 	findOptions.SetLimit(int64(limit))
-	findOptions.SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}) // Sort by relevance
+	findOptions.SetProjection(bson.M{"score": textScore})
+	findOptions.SetSort(sortDocument)
 
 	cursor, err := s.collection.Find(ctx, mongoFilter, findOptions)
 	if err != nil {
@@ -339,6 +824,66 @@ type CarFilterInput struct {
 	Transmission *models.TransmissionType  `json:"transmission"`
 	City         *string                   `json:"city"`
 	State        *string                   `json:"state"`
+	SellerID     *string                   `json:"sellerId"`
+	MatchMode    *models.TextMatchMode     `json:"matchMode"`
+	Near         *NearInput                `json:"near"`
+}
+
+type NearInput struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	RadiusKm float64 `json:"radiusKm"`
+}
+
+// ConnectionArgs are the Relay pagination arguments, first/after pages
+// forward and last/before pages backward
+type ConnectionArgs struct {
+	First  *int
+	After  *string
+	Last   *int
+	Before *string
+}
+
+const (
+	defaultConnectionSize = 10
+	maxConnectionSize     = 100
+)
+
+// pageSize validates the arguments and returns the number of cars to return
+// and whether the page is read backward
+func (a ConnectionArgs) pageSize() (int, bool, error) {
+	if a.First != nil && a.Last != nil {
+		return 0, false, apperrors.BadUserInput("first and last cannot be used together")
+	}
+
+	size, backward, field := defaultConnectionSize, false, "first"
+	if a.First != nil {
+		size = *a.First
+	} else if a.Last != nil {
+		size, backward, field = *a.Last, true, "last"
+	}
+
+	if size < 0 || size > maxConnectionSize {
+		return 0, false, apperrors.BadUserInput(fmt.Sprintf("%s must be between 0 and %d", field, maxConnectionSize))
+	}
+
+	return size, backward, nil
+}
+
+type CarEdge struct {
+	Cursor string
+	Node   *models.Car
+}
+
+type CarConnection struct {
+	Edges           []CarEdge
+	HasNextPage     bool
+	HasPreviousPage bool
+}
+
+type CarSortInput struct {
+	Field     models.CarSortField  `json:"field"`
+	Direction models.SortDirection `json:"direction"`
 }
 
 type LocationInput struct {
@@ -360,12 +905,10 @@ type CarInput struct {
 	Color        string                   `json:"color"`
 	FuelType     models.FuelType          `json:"fuelType"`
 	Transmission models.TransmissionType  `json:"transmission"`
+	VIN          *string                  `json:"vin"`
 	Images       []string                 `json:"images"`
 	Location     LocationInput            `json:"location"`
 	Features     []string                 `json:"features"`
-	SellerName   string                   `json:"sellerName"`
-	SellerEmail  string                   `json:"sellerEmail"`
-	SellerPhone  string                   `json:"sellerPhone"`
 }
 
 type UpdateCarInput struct {
@@ -380,6 +923,7 @@ type UpdateCarInput struct {
 	Color        *string                   `json:"color"`
 	FuelType     *models.FuelType          `json:"fuelType"`
 	Transmission *models.TransmissionType  `json:"transmission"`
+	VIN          *string                   `json:"vin"`
 	Status       *models.CarStatus         `json:"status"`
 	Images       []string                  `json:"images"`
 	Location     *LocationInput            `json:"location"`
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// carSortKeys maps the sortable fields to their document keys
+var carSortKeys = map[models.CarSortField]string{
+	models.CarSortFieldPrice:     "price",
+	models.CarSortFieldYear:      "year",
+	models.CarSortFieldMileage:   "mileage",
+	models.CarSortFieldCreatedAt: "createdAt",
+	models.CarSortFieldDistance:  "distanceKm",
+}
+
+// textScore is the projection and sort value of the text search relevance
+var textScore = bson.M{"$meta": "textScore"}
+
+// defaultCarSort returns the sort used when none is given: best matches for
+// text searches, nearest cars around a point and newest cars otherwise
+func defaultCarSort(textSearch, near bool) *CarSortInput {
+	switch {
+	case textSearch:
+		return &CarSortInput{Field: models.CarSortFieldRelevance, Direction: models.SortDirectionDesc}
+	case near:
+		return &CarSortInput{Field: models.CarSortFieldDistance, Direction: models.SortDirectionAsc}
+	default:
+		return &CarSortInput{Field: models.CarSortFieldCreatedAt, Direction: models.SortDirectionDesc}
+	}
+}
+
+// buildCarSort converts the sort input into a MongoDB sort document. Ties are
+// broken on _id in the same direction so that pages are stable. Relevance is
+// only available for text searches and always sorts the best matches first,
+// distance only when searching around a point.
+func buildCarSort(sort *CarSortInput, textSearch, near bool) (bson.D, error) {
+	if sort == nil {
+		sort = defaultCarSort(textSearch, near)
+	}
+
+	if sort.Field == models.CarSortFieldDistance && !near {
+		return nil, apperrors.BadUserInput("DISTANCE sorting requires a near filter")
+	}
+
+	if sort.Field == models.CarSortFieldRelevance {
+		if !textSearch {
+			return nil, apperrors.BadUserInput("RELEVANCE sorting is only available when searching")
+		}
+		return bson.D{{Key: "score", Value: textScore}, {Key: "_id", Value: -1}}, nil
+	}
+
+	key, ok := carSortKeys[sort.Field]
+	if !ok {
+		return nil, apperrors.BadUserInput("unsupported sort field " + string(sort.Field))
+	}
+
+	direction := -1
+	if sort.Direction == models.SortDirectionAsc {
+		direction = 1
+	}
+
+	return bson.D{{Key: key, Value: direction}, {Key: "_id", Value: direction}}, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// ErrStatusChanged is returned when the status of a car changed while it was being updated
+var ErrStatusChanged = apperrors.Conflict("the status of this car has changed, reload it and try again")
+
+// carTransitions lists the statuses a seller can move a listing to from each
+// status. Listings are only moved to EXPIRED by the system and SOLD is final.
+var carTransitions = map[models.CarStatus][]models.CarStatus{
+	models.CarStatusDraft:     {models.CarStatusAvailable, models.CarStatusWithdrawn},
+	models.CarStatusAvailable: {models.CarStatusPending, models.CarStatusSold, models.CarStatusWithdrawn},
+	models.CarStatusPending:   {models.CarStatusAvailable, models.CarStatusSold, models.CarStatusWithdrawn},
+	models.CarStatusWithdrawn: {models.CarStatusAvailable},
+	models.CarStatusExpired:   {models.CarStatusAvailable, models.CarStatusWithdrawn},
+}
+
+// checkTransition returns a BAD_USER_INPUT error unless a seller can move a
+// listing from one status to the other
+func checkTransition(from, to models.CarStatus) error {
+	for _, allowed := range carTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return apperrors.BadUserInput(fmt.Sprintf("a %s car cannot be changed to %s", from, to))
+}
+
+// newStatusChange records a transition made by actor, or by the system when actor is nil
+func newStatusChange(from *models.CarStatus, to models.CarStatus, actor *models.User, at time.Time) models.StatusChange {
+	change := models.StatusChange{From: from, To: to, At: at}
+	if actor != nil {
+		change.ActorID = &actor.ID
+	}
+	return change
+}
+
+// statusFields returns the fields to set when moving a car between statuses.
+// Publishing a listing, or bringing it back, starts a new listing lifetime,
+// also after a sale falls through since the old one may have ended meanwhile.
+// A published draft is dated from its publication, so that it sorts as new.
+func (s *CarService) statusFields(from, to models.CarStatus, now time.Time) bson.M {
+	fields := bson.M{"status": to}
+	if to == models.CarStatusAvailable {
+		fields["expiresAt"] = now.Add(s.ListingLifetime)
+	}
+	if from == models.CarStatusDraft && to == models.CarStatusAvailable {
+		fields["createdAt"] = now
+	}
+	return fields
+}
+
+// ChangeStatus moves a car owned by the actor to another status of its
+// lifecycle and records the transition in its history
+func (s *CarService) ChangeStatus(ctx context.Context, actor *models.User, id string, to models.CarStatus) (*models.Car, error) {
+	car, err := s.getCarForUpdate(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTransition(car.Status, to); err != nil {
+		return nil, err
+	}
+	if car.Status == models.CarStatusDraft && to == models.CarStatusAvailable {
+		if err := validateListing(car, "car is not ready to be published"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only apply the change if nobody moved the car in the meantime
+	now := time.Now()
+	from := car.Status
+	fields := s.statusFields(from, to, now)
+	fields["updatedAt"] = now
+	fields["activeVin"] = activeVIN(car.VIN, to)
+
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": car.ID, "status": from},
+		bson.M{
+			"$set":  fields,
+			"$push": bson.M{"statusHistory": newStatusChange(&from, to, actor, now)},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateVIN
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update car status: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrStatusChanged
+	}
+
+	return s.GetCarByID(ctx, id)
+}
+
+// RenewCar starts a new lifetime for a listing of the actor. Available
+// listings get a later expiry date, expired ones become available again.
+func (s *CarService) RenewCar(ctx context.Context, actor *models.User, id string) (*models.Car, error) {
+	car, err := s.getCarForUpdate(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch car.Status {
+	case models.CarStatusExpired:
+		return s.ChangeStatus(ctx, actor, id, models.CarStatusAvailable)
+	case models.CarStatusAvailable:
+	default:
+		return nil, apperrors.BadUserInput(fmt.Sprintf("a %s car cannot be renewed", car.Status))
+	}
+
+	now := time.Now()
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": car.ID, "status": models.CarStatusAvailable},
+		bson.M{"$set": bson.M{"expiresAt": now.Add(s.ListingLifetime), "updatedAt": now}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew car: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrStatusChanged
+	}
+
+	return s.GetCarByID(ctx, id)
+}
+
+// ExpireCars moves the available listings whose lifetime ended before now to EXPIRED
+func (s *CarService) ExpireCars(ctx context.Context, now time.Time) (int, error) {
+	from := models.CarStatusAvailable
+	filter := notDeleted()
+	filter["status"] = from
+	filter["expiresAt"] = bson.M{"$lte": now}
+
+	result, err := s.collection.UpdateMany(
+		ctx,
+		filter,
+		bson.M{
+			"$set":  bson.M{"status": models.CarStatusExpired, "updatedAt": now, "activeVin": nil},
+			"$push": bson.M{"statusHistory": newStatusChange(&from, models.CarStatusExpired, nil, now)},
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire cars: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
+
+// MigrateActiveVINs releases the VINs still reserved by listings that are
+// neither available nor pending, or that were deleted
+func (s *CarService) MigrateActiveVINs(ctx context.Context) (int, error) {
+	result, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{
+			"activeVin": bson.M{"$type": "string"},
+			"$or": bson.A{
+				bson.M{"status": bson.M{"$nin": reservingStatuses}},
+				bson.M{"deletedAt": bson.M{"$exists": true}},
+			},
+		},
+		bson.M{"$set": bson.M{"activeVin": nil}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate active VINs: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
+
+// MigrateListingExpiry gives available listings created before expiry
+// existed a full lifetime, instead of expiring them all at once
+func (s *CarService) MigrateListingExpiry(ctx context.Context) (int, error) {
+	result, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"status": models.CarStatusAvailable, "expiresAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"expiresAt": time.Now().Add(s.ListingLifetime)}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate listing expiry: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// ErrDuplicateVIN is returned when another active listing has the same VIN
+var ErrDuplicateVIN = apperrors.Conflict("another active listing already has this VIN")
+
+// vinLength is the length of VINs since the 1981 model year
+const vinLength = 17
+
+// vinWeights are the ISO 3779 weights of each VIN position for the check digit
+var vinWeights = [vinLength]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// vinYearCodes are the model year codes of the 10th position, starting with
+// 1980 and repeating every 30 years
+const vinYearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// firstVINYear is the model year of the first year code
+const firstVINYear = 1980
+
+// normalizeVIN trims and upper-cases a VIN, returning nil for an empty one
+func normalizeVIN(vin string) *string {
+	vin = strings.ToUpper(strings.TrimSpace(vin))
+	if vin == "" {
+		return nil
+	}
+	return &vin
+}
+
+// vinValue returns the transliterated value of a VIN character, or -1 when
+// the character is not allowed. I, O and Q are never used.
+func vinValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'H':
+		return int(c-'A') + 1
+	case c >= 'J' && c <= 'N':
+		return int(c-'J') + 1
+	case c == 'P':
+		return 7
+	case c == 'R':
+		return 9
+	case c >= 'S' && c <= 'Z':
+		return int(c-'S') + 2
+	}
+	return -1
+}
+
+// checkVIN validates the format and check digit of a normalized VIN and,
+// when year is set, that its model year code matches it. It returns the
+// problem found, or an empty string for a valid VIN.
+func checkVIN(vin string, year int) string {
+	if len(vin) != vinLength {
+		return fmt.Sprintf("must be %d characters long", vinLength)
+	}
+
+	sum := 0
+	for i := 0; i < vinLength; i++ {
+		value := vinValue(vin[i])
+		if value < 0 {
+			return "must only contain digits and letters other than I, O and Q"
+		}
+		sum += value * vinWeights[i]
+	}
+
+	check := byte('0' + sum%11)
+	if sum%11 == 10 {
+		check = 'X'
+	}
+	if vin[8] != check {
+		return "has an invalid check digit"
+	}
+
+	code := strings.IndexByte(vinYearCodes, vin[9])
+	if code < 0 {
+		return "has an invalid model year code"
+	}
+	if year != 0 && (year < firstVINYear || (year-firstVINYear)%len(vinYearCodes) != code) {
+		return fmt.Sprintf("model year code %c does not match year %d", vin[9], year)
+	}
+
+	return ""
+}
+
+// invalidVIN returns a BAD_USER_INPUT error for the vin field
+func invalidVIN(message string) error {
+	return apperrors.InvalidFields("invalid VIN", []apperrors.FieldError{{Field: "vin", Message: message}})
+}
+
+// reservingStatuses are the statuses of listings that reserve their VIN.
+// Drafts are not listed yet, and the car of a sold, withdrawn or expired
+// listing can be listed again.
+var reservingStatuses = []models.CarStatus{models.CarStatusAvailable, models.CarStatusPending}
+
+// activeVIN returns the VIN a listing with the given status reserves
+func activeVIN(vin *string, status models.CarStatus) *string {
+	for _, reserving := range reservingStatuses {
+		if status == reserving {
+			return vin
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import "testing"
+
+func TestCheckVIN(t *testing.T) {
+	tests := []struct {
+		name string
+		vin  string
+		year int
+		want string
+	}{
+		{name: "valid", vin: "1HGCM82633A004352", want: ""},
+		{name: "valid with X check digit", vin: "1M8GDM9AXKP042788", want: ""},
+		{name: "matching year", vin: "1HGCM82633A004352", year: 2003, want: ""},
+		{name: "matching year of the next cycle", vin: "1HGCM82633A004352", year: 2033, want: ""},
+		{name: "matching letter year", vin: "1M8GDM9AXKP042788", year: 1989, want: ""},
+		{name: "wrong check digit", vin: "1HGCM82643A004352", want: "has an invalid check digit"},
+		{name: "I is not allowed", vin: "1HGCM8I633A004352", want: "must only contain digits and letters other than I, O and Q"},
+		{name: "O is not allowed", vin: "1HGCM82633A0O4352", want: "must only contain digits and letters other than I, O and Q"},
+		{name: "Q is not allowed", vin: "QHGCM82633A004352", want: "must only contain digits and letters other than I, O and Q"},
+		{name: "lowercase is not allowed", vin: "1hgcm82633a004352", want: "must only contain digits and letters other than I, O and Q"},
+		{name: "too short", vin: "1HGCM82633A00435", want: "must be 17 characters long"},
+		{name: "too long", vin: "1HGCM82633A0043521", want: "must be 17 characters long"},
+		{name: "empty", vin: "", want: "must be 17 characters long"},
+		{name: "invalid year code", vin: "1HGCM82690A004352", want: "has an invalid model year code"},
+		{name: "year mismatch", vin: "1HGCM82633A004352", year: 2004, want: "model year code 3 does not match year 2004"},
+		{name: "year before year codes", vin: "1HGCM82633A004352", year: 1973, want: "model year code 3 does not match year 1973"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkVIN(tt.vin, tt.year); got != tt.want {
+				t.Errorf("checkVIN(%q, %d) = %q, want %q", tt.vin, tt.year, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeVIN(t *testing.T) {
+	if got := normalizeVIN(" 1hgcm82633a004352 "); got == nil || *got != "1HGCM82633A004352" {
+		t.Errorf("normalizeVIN did not trim and upper-case the VIN, got %v", got)
+	}
+	if got := normalizeVIN("  "); got != nil {
+		t.Errorf("normalizeVIN of a blank VIN = %q, want nil", *got)
+	}
+}
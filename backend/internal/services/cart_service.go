@@ -2,158 +2,371 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
 	"github.com/limosnd/marketplace-go-graphql/internal/database"
 	"github.com/limosnd/marketplace-go-graphql/internal/models"
 )
 
+var (
+	// ErrCarNotAvailable is returned when adding a car that is no longer for sale
+	ErrCarNotAvailable = apperrors.BadUserInput("this car is not available")
+	// ErrOwnCar is returned when a seller tries to add their own listing
+	ErrOwnCar = apperrors.BadUserInput("you cannot add your own car to the cart")
+	// ErrInvalidQuantity is returned for quantities other than one
+	ErrInvalidQuantity = apperrors.BadUserInput("each car is unique, quantity must be 1")
+)
+
+// CartOwner identifies a cart either by its user or, for guests, by an anonymous token
+type CartOwner struct {
+	UserID     primitive.ObjectID
+	GuestToken string
+}
+
+// IsGuest reports whether the owner is an anonymous visitor
+func (o CartOwner) IsGuest() bool {
+	return o.UserID.IsZero()
+}
+
+// cartCars looks up the cars of carts, it is implemented by CarService
+type cartCars interface {
+	GetCarByID(ctx context.Context, id string) (*models.Car, error)
+	GetCarsByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Car, error)
+}
+
 type CartService struct {
-	collection    *mongo.Collection
-	carService    *CarService
+	collection  *mongo.Collection
+	legacyItems *mongo.Collection
+	carService  cartCars
 }
 
 // NewCartService creates a new cart service
 func NewCartService() *CartService {
 	return &CartService{
-		collection: database.GetCollection("cart_items"),
-		carService: NewCarService(),
+		collection:  database.GetCollection("carts"),
+		legacyItems: database.GetCollection("cart_items"),
+		carService:  NewCarService(),
 	}
 }
 
-// GetUserCart retrieves the user's cart
-func (s *CartService) GetUserCart(ctx context.Context, userID string) (*models.Cart, error) {
-	objectID, err := primitive.ObjectIDFromHex(userID)
+// GetCart retrieves the owner's cart. Guests without a stored cart get an
+// empty one that is only saved when they add a car.
+func (s *CartService) GetCart(ctx context.Context, owner CartOwner) (*models.Cart, error) {
+	cart, err := s.findCart(ctx, owner)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %v", err)
+		return nil, err
 	}
 
-	// Find all cart items for the user
-	cursor, err := s.collection.Find(ctx, bson.M{"userId": objectID})
+	return s.loadCart(ctx, cart)
+}
+
+// AddToCart adds a car to the owner's cart
+func (s *CartService) AddToCart(ctx context.Context, owner CartOwner, carID string, quantity int) (*models.Cart, error) {
+	// Every car is a unique vehicle
+	if quantity != 1 {
+		return nil, ErrInvalidQuantity
+	}
+
+	// Validate the car
+	car, err := s.carService.GetCarByID(ctx, carID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find cart items: %v", err)
+		return nil, err
+	}
+	if car.Status != models.CarStatusAvailable {
+		return nil, ErrCarNotAvailable
+	}
+	if !owner.IsGuest() && car.SellerID == owner.UserID {
+		return nil, ErrOwnCar
 	}
-	defer cursor.Close(ctx)
 
-	var items []models.CartItem
-	var total float64
+	cart, err := s.findOrCreateCart(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
 
-	for cursor.Next(ctx) {
-		var item models.CartItem
-		if err := cursor.Decode(&item); err != nil {
-			return nil, fmt.Errorf("failed to decode cart item: %v", err)
-		}
+	if err := s.pushItem(ctx, cart.ID, car.ID, time.Now()); err != nil {
+		return nil, err
+	}
 
-		// Get car details
-		car, err := s.carService.GetCarByID(ctx, item.CarID.Hex())
-		if err != nil {
-			continue // Skip if car not found
-		}
-		
-		item.Car = car
-		total += car.Price * float64(item.Quantity)
-		items = append(items, item)
+	return s.getCartByID(ctx, cart.ID)
+}
+
+// RemoveFromCart removes a car from the owner's cart
+func (s *CartService) RemoveFromCart(ctx context.Context, owner CartOwner, carID string) (*models.Cart, error) {
+	carObjectID, err := primitive.ObjectIDFromHex(carID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid car ID: %v", err)
 	}
 
-	cart := &models.Cart{
-		ID:     primitive.NewObjectID(),
-		UserID: objectID,
-		Items:  items,
-		Total:  total,
+	cart, err := s.findCart(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if cart.ID.IsZero() {
+		return cart, nil // Nothing stored to remove from
 	}
 
-	return cart, nil
+	_, err = s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": cart.ID},
+		bson.M{
+			"$pull": bson.M{"items": bson.M{"carId": carObjectID}},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove item from cart: %v", err)
+	}
+
+	return s.getCartByID(ctx, cart.ID)
 }
 
-// AddToCart adds an item to the user's cart
-func (s *CartService) AddToCart(ctx context.Context, userID, carID string, quantity int) (*models.Cart, error) {
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+// ClearCart removes all items from the owner's cart
+func (s *CartService) ClearCart(ctx context.Context, owner CartOwner) error {
+	cart, err := s.findCart(ctx, owner)
+	if err != nil || cart.ID.IsZero() {
+		return err
+	}
+
+	_, err = s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": cart.ID},
+		bson.M{"$set": bson.M{"items": []models.CartItem{}, "updatedAt": time.Now()}},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %v", err)
+		return fmt.Errorf("failed to clear cart: %v", err)
 	}
 
-	carObjectID, err := primitive.ObjectIDFromHex(carID)
+	return nil
+}
+
+// MergeGuestCart moves the items of a guest cart into the user's cart and
+// deletes the guest cart. Unknown tokens leave the user's cart untouched.
+func (s *CartService) MergeGuestCart(ctx context.Context, userID primitive.ObjectID, guestToken string) (*models.Cart, error) {
+	userCart, err := s.findOrCreateCart(ctx, CartOwner{UserID: userID})
 	if err != nil {
-		return nil, fmt.Errorf("invalid car ID: %v", err)
+		return nil, err
 	}
 
-	// Check if item already exists in cart
-	existingItem := &models.CartItem{}
-	err = s.collection.FindOne(ctx, bson.M{
-		"userId": userObjectID,
-		"carId":  carObjectID,
-	}).Decode(existingItem)
-
-	if err == nil {
-		// Update quantity if item exists
-		_, err = s.collection.UpdateOne(
-			ctx,
-			bson.M{"_id": existingItem.ID},
-			bson.M{"$set": bson.M{"quantity": existingItem.Quantity + quantity}},
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to update cart item: %v", err)
-		}
-	} else if err == mongo.ErrNoDocuments {
-		// Create new cart item
-		newItem := &models.CartItem{
-			ID:       primitive.NewObjectID(),
-			UserID:   userObjectID,
-			CarID:    carObjectID,
-			Quantity: quantity,
-			AddedAt:  time.Now(),
+	guestCart := &models.Cart{}
+	err = s.collection.FindOne(ctx, bson.M{"guestToken": guestToken}).Decode(guestCart)
+	if err == mongo.ErrNoDocuments {
+		return s.loadCart(ctx, userCart)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find guest cart: %v", err)
+	}
+
+	cars, err := s.carService.GetCarsByIDs(ctx, cartCarIDs(guestCart))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range guestCart.Items {
+		car, ok := cars[item.CarID]
+		if !ok || car.DeletedAt != nil || car.SellerID == userID {
+			continue // Skip cars that are gone or listed by the user
 		}
 
-		_, err = s.collection.InsertOne(ctx, newItem)
-		if err != nil {
-			return nil, fmt.Errorf("failed to add item to cart: %v", err)
+		if err := s.pushItem(ctx, userCart.ID, item.CarID, item.AddedAt); err != nil {
+			return nil, err
 		}
-	} else {
-		return nil, fmt.Errorf("failed to check existing cart item: %v", err)
 	}
 
-	return s.GetUserCart(ctx, userID)
+	_, err = s.collection.DeleteOne(ctx, bson.M{"_id": guestCart.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete guest cart: %v", err)
+	}
+
+	return s.getCartByID(ctx, userCart.ID)
 }
 
-// RemoveFromCart removes an item from the user's cart
-func (s *CartService) RemoveFromCart(ctx context.Context, userID, carID string) (*models.Cart, error) {
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+// getCartByID retrieves a stored cart with its cars
+func (s *CartService) getCartByID(ctx context.Context, id primitive.ObjectID) (*models.Cart, error) {
+	cart := &models.Cart{}
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(cart)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %v", err)
+		return nil, fmt.Errorf("failed to find cart: %v", err)
 	}
 
-	carObjectID, err := primitive.ObjectIDFromHex(carID)
+	return s.loadCart(ctx, cart)
+}
+
+// pushItem adds a car to a cart unless it is already there
+func (s *CartService) pushItem(ctx context.Context, cartID, carID primitive.ObjectID, addedAt time.Time) error {
+	newItem := models.CartItem{
+		ID:       primitive.NewObjectID(),
+		CarID:    carID,
+		Quantity: 1,
+		AddedAt:  addedAt,
+	}
+
+	_, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": cartID, "items.carId": bson.M{"$ne": carID}},
+		bson.M{
+			"$push": bson.M{"items": newItem},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("invalid car ID: %v", err)
+		return fmt.Errorf("failed to add item to cart: %v", err)
 	}
 
-	_, err = s.collection.DeleteOne(ctx, bson.M{
-		"userId": userObjectID,
-		"carId":  carObjectID,
-	})
+	return nil
+}
+
+// findCart returns the stored cart document of the owner without storing a
+// new one for guests. Guests without a stored cart get an empty cart without
+// ID or token, served with a null ID, so that anonymous page views do not
+// create documents.
+func (s *CartService) findCart(ctx context.Context, owner CartOwner) (*models.Cart, error) {
+	if !owner.IsGuest() {
+		return s.findOrCreateCart(ctx, owner)
+	}
+
+	if owner.GuestToken != "" {
+		cart := &models.Cart{}
+		err := s.collection.FindOne(ctx, bson.M{"guestToken": owner.GuestToken}).Decode(cart)
+		if err == nil {
+			return cart, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to find cart: %v", err)
+		}
+	}
+
+	now := time.Now()
+	return &models.Cart{Items: []models.CartItem{}, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+// findOrCreateCart returns the stored cart document of the owner. Guests
+// without a known token get a new cart with a fresh token.
+func (s *CartService) findOrCreateCart(ctx context.Context, owner CartOwner) (*models.Cart, error) {
+	filter := bson.M{"userId": owner.UserID}
+	if owner.IsGuest() {
+		if owner.GuestToken == "" {
+			token, err := newGuestToken()
+			if err != nil {
+				return nil, err
+			}
+			owner.GuestToken = token
+		}
+		filter = bson.M{"guestToken": owner.GuestToken}
+	}
+
+	// Create the cart on first use, the filter fields are copied into the new document
+	now := time.Now()
+	result, err := s.collection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$setOnInsert": bson.M{"items": []models.CartItem{}, "createdAt": now, "updatedAt": now}},
+		options.Update().SetUpsert(true),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to remove item from cart: %v", err)
+		return nil, fmt.Errorf("failed to create cart: %v", err)
+	}
+
+	cart := &models.Cart{}
+	if err := s.collection.FindOne(ctx, filter).Decode(cart); err != nil {
+		return nil, fmt.Errorf("failed to find cart: %v", err)
+	}
+
+	// Adopt items stored before carts were persisted
+	if result.UpsertedID != nil && !owner.IsGuest() {
+		if err := s.migrateLegacyItems(ctx, cart); err != nil {
+			return nil, err
+		}
+		if err := s.collection.FindOne(ctx, filter).Decode(cart); err != nil {
+			return nil, fmt.Errorf("failed to find cart: %v", err)
+		}
 	}
 
-	return s.GetUserCart(ctx, userID)
+	return cart, nil
 }
 
-// ClearCart removes all items from the user's cart
-func (s *CartService) ClearCart(ctx context.Context, userID string) error {
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
+// migrateLegacyItems moves the user's documents from the old cart_items collection into the cart
+func (s *CartService) migrateLegacyItems(ctx context.Context, cart *models.Cart) error {
+	cursor, err := s.legacyItems.Find(ctx, bson.M{"userId": cart.UserID})
 	if err != nil {
-		return fmt.Errorf("invalid user ID: %v", err)
+		return fmt.Errorf("failed to find cart items: %v", err)
 	}
+	defer cursor.Close(ctx)
 
-	_, err = s.collection.DeleteMany(ctx, bson.M{"userId": userObjectID})
+	var items []models.CartItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return fmt.Errorf("failed to decode cart items: %v", err)
+	}
+
+	for _, item := range items {
+		if err := s.pushItem(ctx, cart.ID, item.CarID, item.AddedAt); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.legacyItems.DeleteMany(ctx, bson.M{"userId": cart.UserID})
 	if err != nil {
-		return fmt.Errorf("failed to clear cart: %v", err)
+		return fmt.Errorf("failed to delete cart items: %v", err)
 	}
 
 	return nil
 }
+
+// loadCart fills in the cars of a cart and computes the total of the items
+// that are still available. All cars are fetched with a single query
+// regardless of the number of items.
+func (s *CartService) loadCart(ctx context.Context, cart *models.Cart) (*models.Cart, error) {
+	cars, err := s.carService.GetCarsByIDs(ctx, cartCarIDs(cart))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.CartItem
+	var total float64
+
+	for _, item := range cart.Items {
+		// Get car details
+		car, ok := cars[item.CarID]
+		if !ok {
+			continue // Skip cars that were purged
+		}
+
+		item.Car = car
+		item.Available = car.IsAvailable()
+		if item.Available {
+			total += car.Price * float64(item.Quantity)
+		}
+		items = append(items, item)
+	}
+
+	cart.Items = items
+	cart.Total = total
+	return cart, nil
+}
+
+// cartCarIDs returns the IDs of the cars in a cart
+func cartCarIDs(cart *models.Cart) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		ids = append(ids, item.CarID)
+	}
+	return ids
+}
+
+// newGuestToken generates a random token identifying a guest cart
+func newGuestToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate guest token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
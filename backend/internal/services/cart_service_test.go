@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// countingCars serves cars from memory and counts the lookups that would be
+// database round trips
+type countingCars struct {
+	cars    map[primitive.ObjectID]*models.Car
+	lookups int
+}
+
+func (c *countingCars) GetCarByID(ctx context.Context, id string) (*models.Car, error) {
+	c.lookups++
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	if car, ok := c.cars[objectID]; ok {
+		return car, nil
+	}
+	return nil, ErrCarNotFound
+}
+
+func (c *countingCars) GetCarsByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Car, error) {
+	c.lookups++
+	cars := make(map[primitive.ObjectID]*models.Car, len(ids))
+	for _, id := range ids {
+		if car, ok := c.cars[id]; ok {
+			cars[id] = car
+		}
+	}
+	return cars, nil
+}
+
+// BenchmarkCartService_GetCart loads carts of growing size and checks that
+// their cars are always fetched with a single lookup
+func BenchmarkCartService_GetCart(b *testing.B) {
+	ctx := context.Background()
+
+	for _, size := range []int{1, 50, 500} {
+		b.Run(fmt.Sprintf("items=%d", size), func(b *testing.B) {
+			cars := &countingCars{cars: make(map[primitive.ObjectID]*models.Car, size)}
+			cart := &models.Cart{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+			for i := 0; i < size; i++ {
+				car := &models.Car{ID: primitive.NewObjectID(), Price: 1000, Status: models.CarStatusAvailable}
+				cars.cars[car.ID] = car
+				cart.Items = append(cart.Items, models.CartItem{
+					ID:       primitive.NewObjectID(),
+					CarID:    car.ID,
+					Quantity: 1,
+					AddedAt:  time.Now(),
+				})
+			}
+			service := &CartService{carService: cars}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stored := *cart
+				loaded, err := service.loadCart(ctx, &stored)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(loaded.Items) != size {
+					b.Fatalf("loaded %d items, want %d", len(loaded.Items), size)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(cars.lookups)/float64(b.N), "lookups/op")
+			if cars.lookups != b.N {
+				b.Fatalf("%d car lookups for %d carts, want one per cart", cars.lookups, b.N)
+			}
+		})
+	}
+}
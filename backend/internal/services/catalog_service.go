@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/database"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+)
+
+// carCatalog is the bundled catalog of brands and models the collection is seeded from
+//
+//go:embed car_catalog.json
+var carCatalog []byte
+
+type CatalogService struct {
+	collection *mongo.Collection
+}
+
+// NewCatalogService creates a new catalog service
+func NewCatalogService() *CatalogService {
+	return &CatalogService{
+		collection: database.GetCollection("car_catalog"),
+	}
+}
+
+// catalogKey is the form names and aliases are compared in, ignoring case and
+// spacing like the search keys of cars
+func catalogKey(name string) string {
+	return searchKey(name)
+}
+
+// catalogKeys returns the distinct keys of a name and its aliases
+func catalogKeys(name string, aliases []string) []string {
+	keys := []string{catalogKey(name)}
+	for _, alias := range aliases {
+		key := catalogKey(alias)
+		if key != "" && !contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SeedCatalog creates or updates the brands of the bundled catalog. Brands
+// only present in the database are left untouched.
+func (s *CatalogService) SeedCatalog(ctx context.Context) (int, error) {
+	var brands []models.CatalogBrand
+	if err := json.Unmarshal(carCatalog, &brands); err != nil {
+		return 0, fmt.Errorf("failed to parse car catalog: %v", err)
+	}
+
+	writes := make([]mongo.WriteModel, len(brands))
+	for i, brand := range brands {
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"name": brand.Name}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"aliases": brand.Aliases,
+				"models":  brand.Models,
+				"keys":    catalogKeys(brand.Name, brand.Aliases),
+			}}).
+			SetUpsert(true)
+	}
+
+	result, err := s.collection.BulkWrite(ctx, writes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to seed car catalog: %v", err)
+	}
+
+	return int(result.UpsertedCount + result.ModifiedCount), nil
+}
+
+// findBrand retrieves the brand whose name or alias matches the input, or nil
+func (s *CatalogService) findBrand(ctx context.Context, name string) (*models.CatalogBrand, error) {
+	key := catalogKey(name)
+	if key == "" {
+		return nil, nil
+	}
+
+	var brand models.CatalogBrand
+	err := s.collection.FindOne(ctx, bson.M{"keys": key}).Decode(&brand)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find brand: %v", err)
+	}
+
+	return &brand, nil
+}
+
+// findModel returns the model of a brand whose name or alias matches the input, or nil
+func findModel(brand *models.CatalogBrand, name string) *models.CatalogModel {
+	key := catalogKey(name)
+	for i, model := range brand.Models {
+		if contains(catalogKeys(model.Name, model.Aliases), key) {
+			return &brand.Models[i]
+		}
+	}
+	return nil
+}
+
+// Normalize returns the catalog names of a brand and model given as free
+// text. Names missing from the catalog are only trimmed, so that makes and
+// models it does not know yet can still be listed.
+func (s *CatalogService) Normalize(ctx context.Context, brand, model string) (string, string, error) {
+	brand, model = strings.TrimSpace(brand), strings.TrimSpace(model)
+
+	found, err := s.findBrand(ctx, brand)
+	if err != nil || found == nil {
+		return brand, model, err
+	}
+
+	if foundModel := findModel(found, model); foundModel != nil {
+		model = foundModel.Name
+	}
+
+	return found.Name, model, nil
+}
+
+// Brands returns the names of the catalog brands in alphabetical order
+func (s *CatalogService) Brands(ctx context.Context) ([]string, error) {
+	findOptions := options.Find().
+		SetProjection(bson.M{"name": 1}).
+		SetSort(bson.M{"name": 1})
+
+	cursor, err := s.collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find brands: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var brands []models.CatalogBrand
+	if err = cursor.All(ctx, &brands); err != nil {
+		return nil, fmt.Errorf("failed to decode brands: %v", err)
+	}
+
+	names := make([]string, len(brands))
+	for i, brand := range brands {
+		names[i] = brand.Name
+	}
+	return names, nil
+}
+
+// Models returns the names of the models of a brand, given by name or alias,
+// in alphabetical order. Brands missing from the catalog have no models.
+func (s *CatalogService) Models(ctx context.Context, brand string) ([]string, error) {
+	found, err := s.findBrand(ctx, brand)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	if found == nil {
+		return names, nil
+	}
+	for _, model := range found.Models {
+		names = append(names, model.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// normalizeNames replaces the brand and model of an update of a car, or of a
+// new draft when car is nil, by their catalog names. When only one of them
+// changes the other one is read from the car.
+func (s *CarService) normalizeNames(ctx context.Context, input *UpdateCarInput, car *models.Car) error {
+	if input.Brand == nil && input.Model == nil {
+		return nil
+	}
+
+	var brand, model string
+	if car != nil {
+		brand, model = car.Brand, car.Model
+	}
+	if input.Brand != nil {
+		brand = *input.Brand
+	}
+	if input.Model != nil {
+		model = *input.Model
+	}
+
+	brand, model, err := s.catalog.Normalize(ctx, brand, model)
+	if err != nil {
+		return err
+	}
+	if input.Brand != nil {
+		input.Brand = &brand
+	}
+	if input.Model != nil {
+		input.Model = &model
+	}
+	return nil
+}
+
+// carFilter builds the query of a filter after replacing a brand or model
+// alias by its catalog name, since listings are stored with those
+func (s *CarService) carFilter(ctx context.Context, filter *CarFilterInput) (*carQuery, error) {
+	if filter == nil || filter.Brand == nil || len(*filter.Brand) > maxTextFilterLength {
+		return buildCarFilter(filter)
+	}
+
+	model := ""
+	if filter.Model != nil {
+		model = *filter.Model
+	}
+	brand, model, err := s.catalog.Normalize(ctx, *filter.Brand, model)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := *filter
+	normalized.Brand = &brand
+	if filter.Model != nil {
+		normalized.Model = &model
+	}
+	return buildCarFilter(&normalized)
+}
+
+// carStatuses lists every status, matching any of them lets a query on the
+// search keys use the indexes that start with the status
+var carStatuses = []models.CarStatus{
+	models.CarStatusDraft,
+	models.CarStatusAvailable,
+	models.CarStatusPending,
+	models.CarStatusSold,
+	models.CarStatusWithdrawn,
+	models.CarStatusExpired,
+}
+
+// MigrateCatalogNames replaces the brand and model aliases stored by listings
+// created before the catalog, or before it last changed, by their catalog
+// names. Listings are matched on their search keys, which are normalized like
+// catalog keys.
+func (s *CarService) MigrateCatalogNames(ctx context.Context) (int, error) {
+	cursor, err := s.catalog.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find brands: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var brands []models.CatalogBrand
+	if err = cursor.All(ctx, &brands); err != nil {
+		return 0, fmt.Errorf("failed to decode brands: %v", err)
+	}
+
+	migrated := 0
+	for _, brand := range brands {
+		branches, keyBranches := bson.A{}, bson.A{}
+		for _, catalogModel := range brand.Models {
+			matches := bson.M{"$in": bson.A{"$" + modelSearchKey, catalogKeys(catalogModel.Name, catalogModel.Aliases)}}
+			branches = append(branches, bson.M{"case": matches, "then": catalogModel.Name})
+			keyBranches = append(keyBranches, bson.M{"case": matches, "then": searchKey(catalogModel.Name)})
+		}
+		fields := bson.M{"brand": brand.Name, brandSearchKey: searchKey(brand.Name)}
+		if len(branches) > 0 {
+			fields["model"] = bson.M{"$switch": bson.M{"branches": branches, "default": "$model"}}
+			fields[modelSearchKey] = bson.M{"$switch": bson.M{"branches": keyBranches, "default": "$" + modelSearchKey}}
+		}
+
+		result, err := s.collection.UpdateMany(
+			ctx,
+			bson.M{
+				"status":       bson.M{"$in": carStatuses},
+				brandSearchKey: bson.M{"$in": catalogKeys(brand.Name, brand.Aliases)},
+			},
+			mongo.Pipeline{{{Key: "$set", Value: fields}}},
+		)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate cars of %s: %v", brand.Name, err)
+		}
+		migrated += int(result.ModifiedCount)
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
+	"github.com/limosnd/marketplace-go-graphql/internal/imaging"
+	"github.com/limosnd/marketplace-go-graphql/internal/models"
+	"github.com/limosnd/marketplace-go-graphql/internal/storage"
+)
+
+const (
+	// MaxImageSize is the largest image that can be uploaded
+	MaxImageSize = 10 << 20
+	// maxCarImages bounds the number of images of a listing
+	maxCarImages = 20
+	// ImagePathPrefix is the path images are served from
+	ImagePathPrefix = "/images/"
+)
+
+// imageSizes are the variants generated for every uploaded image
+var imageSizes = []imaging.Size{
+	{Name: string(models.ImageSizeThumbnail), MaxDimension: 320},
+	{Name: string(models.ImageSizeMedium), MaxDimension: 800},
+	{Name: string(models.ImageSizeFull), MaxDimension: 1920},
+}
+
+// imageExtensions lists the accepted image types with the extension of their variants
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".jpg",
+}
+
+var (
+	// ErrTooManyImages is returned when a listing already has the maximum number of images
+	ErrTooManyImages = apperrors.BadUserInput(fmt.Sprintf("a car can have at most %d images", maxCarImages))
+	// ErrImageNotFound is returned for image IDs that do not belong to the car
+	ErrImageNotFound = apperrors.NotFound("image not found")
+	// ErrImagesChanged is returned when the images of a car changed while they were being updated
+	ErrImagesChanged = apperrors.Conflict("the images of this car have changed, reload it and try again")
+)
+
+// ImageUpload is an uploaded file as received from the client
+type ImageUpload struct {
+	File        io.Reader
+	Filename    string
+	Size        int64
+	ContentType string
+}
+
+type ImageService struct {
+	cars  *CarService
+	store storage.BlobStore
+}
+
+// NewImageService creates a new image service storing images in store
+func NewImageService(cars *CarService, store storage.BlobStore) *ImageService {
+	s := &ImageService{
+		cars:  cars,
+		store: store,
+	}
+	cars.deleteImages = s.deleteBlobs
+	return s
+}
+
+// UploadCarImage stores the variants of an image of a car owned by the actor
+// and appends it to the car's images. The first image becomes the cover.
+func (s *ImageService) UploadCarImage(ctx context.Context, actor *models.User, carID string, upload ImageUpload) (*models.Car, error) {
+	car, err := s.cars.getCarForUpdate(ctx, actor, carID)
+	if err != nil {
+		return nil, err
+	}
+	if len(car.Images) >= maxCarImages {
+		return nil, ErrTooManyImages
+	}
+
+	data, err := readImage(upload)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := imaging.Process(data, imageSizes)
+	if errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrTooManyPixels) {
+		return nil, invalidImage(err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to process image: %v", err)
+	}
+
+	image := models.CarImage{
+		ID:      primitive.NewObjectID().Hex(),
+		IsCover: len(car.Images) == 0,
+	}
+	for _, variant := range variants {
+		key := fmt.Sprintf("cars/%s/%s/%s%s", car.ID.Hex(), image.ID, strings.ToLower(variant.Name), imageExtensions[variant.ContentType])
+		err := s.store.Put(ctx, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType)
+		if err != nil {
+			s.deleteBlobs(ctx, image)
+			return nil, err
+		}
+
+		image.Variants = append(image.Variants, models.ImageVariant{
+			Size:   models.ImageSize(variant.Name),
+			URL:    ImagePathPrefix + key,
+			Key:    key,
+			Width:  variant.Width,
+			Height: variant.Height,
+		})
+	}
+
+	// Only add the image while the limit still holds
+	result, err := s.cars.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": car.ID, fmt.Sprintf("images.%d", maxCarImages-1): bson.M{"$exists": false}},
+		bson.M{
+			"$push": bson.M{"images": image},
+			"$set":  bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		s.deleteBlobs(ctx, image)
+		return nil, fmt.Errorf("failed to add image: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		s.deleteBlobs(ctx, image)
+		return nil, ErrTooManyImages
+	}
+
+	return s.cars.GetCarByID(ctx, carID)
+}
+
+// ReorderCarImages puts the images of a car owned by the actor in the given
+// order, which must list every image once. The cover is kept unless another
+// one is given.
+func (s *ImageService) ReorderCarImages(ctx context.Context, actor *models.User, carID string, imageIDs []string, coverImageID *string) (*models.Car, error) {
+	car, err := s.cars.getCarForUpdate(ctx, actor, carID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.CarImage, len(car.Images))
+	coverID := ""
+	for _, image := range car.Images {
+		byID[image.ID] = image
+		if image.IsCover {
+			coverID = image.ID
+		}
+	}
+	if coverImageID != nil {
+		if _, ok := byID[*coverImageID]; !ok {
+			return nil, ErrImageNotFound
+		}
+		coverID = *coverImageID
+	}
+
+	if len(imageIDs) != len(car.Images) {
+		return nil, apperrors.BadUserInput("imageIds must list every image of the car exactly once")
+	}
+	images := make([]models.CarImage, 0, len(imageIDs))
+	for _, id := range imageIDs {
+		image, ok := byID[id]
+		if !ok {
+			return nil, apperrors.BadUserInput("imageIds must list every image of the car exactly once")
+		}
+		delete(byID, id)
+		images = append(images, image)
+	}
+
+	if err := s.replaceImages(ctx, car, withCover(images, coverID)); err != nil {
+		return nil, err
+	}
+
+	return s.cars.GetCarByID(ctx, carID)
+}
+
+// DeleteCarImage removes an image of a car owned by the actor together with
+// its stored variants. When the cover is removed the next image becomes the cover.
+func (s *ImageService) DeleteCarImage(ctx context.Context, actor *models.User, carID, imageID string) (*models.Car, error) {
+	car, err := s.cars.getCarForUpdate(ctx, actor, carID)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted *models.CarImage
+	coverID := ""
+	images := make([]models.CarImage, 0, len(car.Images))
+	for i, image := range car.Images {
+		if image.ID == imageID {
+			deleted = &car.Images[i]
+			continue
+		}
+		if image.IsCover {
+			coverID = image.ID
+		}
+		images = append(images, image)
+	}
+	if deleted == nil {
+		return nil, ErrImageNotFound
+	}
+
+	if err := s.replaceImages(ctx, car, withCover(images, coverID)); err != nil {
+		return nil, err
+	}
+	s.deleteBlobs(ctx, *deleted)
+
+	return s.cars.GetCarByID(ctx, carID)
+}
+
+// replaceImages stores the new images of a car, unless its images changed since it was read
+func (s *ImageService) replaceImages(ctx context.Context, car *models.Car, images []models.CarImage) error {
+	filter := bson.M{"_id": car.ID, "images": bson.M{"$size": len(car.Images)}}
+	if len(car.Images) > 0 {
+		ids := make([]string, len(car.Images))
+		for i, image := range car.Images {
+			ids[i] = image.ID
+		}
+		filter["images._id"] = bson.M{"$all": ids}
+	}
+
+	result, err := s.cars.collection.UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"images": images, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update images: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrImagesChanged
+	}
+
+	return nil
+}
+
+// withCover marks the image with the given ID as the only cover, or the first
+// image when there is no such image
+func withCover(images []models.CarImage, coverID string) []models.CarImage {
+	found := false
+	for i := range images {
+		images[i].IsCover = images[i].ID == coverID
+		found = found || images[i].IsCover
+	}
+	if !found && len(images) > 0 {
+		images[0].IsCover = true
+	}
+	return images
+}
+
+// deleteBlobs removes the stored variants of images, failures only leave orphaned blobs
+func (s *ImageService) deleteBlobs(ctx context.Context, images ...models.CarImage) {
+	for _, image := range images {
+		for _, variant := range image.Variants {
+			if variant.Key == "" {
+				continue // External image
+			}
+			if err := s.store.Delete(ctx, variant.Key); err != nil {
+				log.Printf("Failed to delete image %s: %v", variant.Key, err)
+			}
+		}
+	}
+}
+
+// invalidImage returns a BAD_USER_INPUT error for the uploaded file
+func invalidImage(message string) error {
+	return apperrors.InvalidFields("invalid image", []apperrors.FieldError{{Field: "file", Message: message}})
+}
+
+// readImage reads an upload and checks its size and type. The type is sniffed
+// from the content, the type claimed by the client is not trusted.
+func readImage(upload ImageUpload) ([]byte, error) {
+	if upload.Size > MaxImageSize {
+		return nil, invalidImage(fmt.Sprintf("must be at most %d MB", MaxImageSize>>20))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(upload.File, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	if len(data) > MaxImageSize {
+		return nil, invalidImage(fmt.Sprintf("must be at most %d MB", MaxImageSize>>20))
+	}
+	if len(data) == 0 {
+		return nil, invalidImage("must not be empty")
+	}
+
+	if _, ok := imageExtensions[http.DetectContentType(data)]; !ok {
+		return nil, invalidImage("must be a JPEG, PNG or WebP image")
+	}
+
+	return data, nil
+}
@@ -2,21 +2,44 @@ package services
 
 import (
 	"context"
-	"errors"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/limosnd/marketplace-go-graphql/internal/apperrors"
 	"github.com/limosnd/marketplace-go-graphql/internal/database"
 	"github.com/limosnd/marketplace-go-graphql/internal/models"
 )
 
+const minPasswordLength = 6
+
+// claimTokenLifetime is how long a token to claim an account stays valid
+const claimTokenLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidCredentials = apperrors.Unauthenticated("invalid email or password")
+	ErrEmailTaken         = apperrors.BadUserInput("user with this email already exists")
+	ErrUserNotFound       = apperrors.NotFound("user not found")
+	ErrInvalidClaimToken  = apperrors.BadUserInput("invalid or expired claim token")
+	ErrNotClaimable       = apperrors.BadUserInput("only passwordless accounts of migrated listings can be claimed")
+)
+
 type UserService struct {
 	collection *mongo.Collection
+	// AdminEmail is the email of the admin account created at startup, no
+	// other account can register it or change its email to it
+	AdminEmail string
 }
 
 // NewUserService creates a new user service
@@ -26,13 +49,106 @@ func NewUserService() *UserService {
 	}
 }
 
+// AdminFromEnv returns the email and password of the admin account given by
+// ADMIN_EMAIL and ADMIN_PASSWORD, which is how the first admin of a
+// deployment is created. Further admins are appointed with setUserRole.
+func AdminFromEnv() (string, string, error) {
+	email := strings.TrimSpace(os.Getenv("ADMIN_EMAIL"))
+	if email == "" {
+		return "", "", nil
+	}
+	if !strings.Contains(email, "@") {
+		return "", "", fmt.Errorf("ADMIN_EMAIL must be a valid email")
+	}
+	password := os.Getenv("ADMIN_PASSWORD")
+	if len(password) < minPasswordLength {
+		return "", "", fmt.Errorf("ADMIN_PASSWORD must be at least %d characters long", minPasswordLength)
+	}
+	return email, password, nil
+}
+
+// isAdminEmail reports whether an email is the admin email, ignoring case
+func (s *UserService) isAdminEmail(email string) bool {
+	return s.AdminEmail != "" && strings.EqualFold(s.AdminEmail, email)
+}
+
+// CreateAdmin creates the admin account with the given password, and reports
+// whether it did. An existing account with the admin email is never promoted,
+// nothing proves that whoever registered it is the operator.
+func (s *UserService) CreateAdmin(ctx context.Context, password string) (bool, error) {
+	if s.AdminEmail == "" {
+		return false, nil
+	}
+
+	existing := &models.User{}
+	err := s.collection.FindOne(
+		ctx,
+		bson.M{"email": s.AdminEmail},
+		options.FindOne().SetCollation(caseInsensitive),
+	).Decode(existing)
+	if err == nil {
+		if existing.Role != models.UserRoleAdmin {
+			return false, fmt.Errorf("account %s already exists and is not an admin, appoint it with setUserRole", existing.Email)
+		}
+		return false, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return false, fmt.Errorf("failed to check admin account: %v", err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	now := time.Now()
+	_, err = s.collection.InsertOne(ctx, &models.User{
+		ID:        primitive.NewObjectID(),
+		Name:      "Admin",
+		Email:     s.AdminEmail,
+		Password:  string(hashedPassword),
+		Role:      models.UserRoleAdmin,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create admin account: %v", err)
+	}
+
+	return true, nil
+}
+
 // Register creates a new user account
 func (s *UserService) Register(ctx context.Context, input *models.RegisterInput) (*models.User, error) {
-	// Check if user already exists
-	existing := &models.User{}
-	err := s.collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(existing)
+	// Validate input
+	input.Email = strings.TrimSpace(input.Email)
+	if input.Name == "" || !strings.Contains(input.Email, "@") {
+		return nil, apperrors.BadUserInput("name and a valid email are required")
+	}
+	if len(input.Password) < minPasswordLength {
+		return nil, apperrors.BadUserInput(fmt.Sprintf("password must be at least %d characters long", minPasswordLength))
+	}
+
+	// Only buyer and seller accounts can be self-registered
+	role := models.UserRoleBuyer
+	if input.Role != nil {
+		if *input.Role != models.UserRoleBuyer && *input.Role != models.UserRoleSeller {
+			return nil, apperrors.BadUserInput("role must be BUYER or SELLER")
+		}
+		role = *input.Role
+	}
+
+	// Check if user already exists. Passwordless accounts of migrated listings
+	// are taken too, they can only be claimed with a token issued by an admin.
+	if s.isAdminEmail(input.Email) {
+		return nil, ErrEmailTaken
+	}
+	err := s.collection.FindOne(ctx, bson.M{"email": input.Email}).Err()
 	if err == nil {
-		return nil, errors.New("user with this email already exists")
+		return nil, ErrEmailTaken
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to check existing user: %v", err)
 	}
 
 	// Hash password
@@ -48,13 +164,17 @@ func (s *UserService) Register(ctx context.Context, input *models.RegisterInput)
 		Email:     input.Email,
 		Password:  string(hashedPassword),
 		Phone:     input.Phone,
-		Role:      models.UserRoleBuyer,
+		Role:      role,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
 	_, err = s.collection.InsertOne(ctx, user)
 	if err != nil {
+		// A concurrent registration with the same email won the race
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
 		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
@@ -66,10 +186,10 @@ func (s *UserService) Register(ctx context.Context, input *models.RegisterInput)
 // Login authenticates a user
 func (s *UserService) Login(ctx context.Context, input *models.LoginInput) (*models.User, error) {
 	user := &models.User{}
-	err := s.collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(user)
+	err := s.collection.FindOne(ctx, bson.M{"email": strings.TrimSpace(input.Email)}).Decode(user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("invalid email or password")
+			return nil, ErrInvalidCredentials
 		}
 		return nil, fmt.Errorf("failed to find user: %v", err)
 	}
@@ -77,7 +197,114 @@ func (s *UserService) Login(ctx context.Context, input *models.LoginInput) (*mod
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
 	if err != nil {
-		return nil, errors.New("invalid email or password")
+		return nil, ErrInvalidCredentials
+	}
+
+	// Don't return password
+	user.Password = ""
+	return user, nil
+}
+
+// hashClaimToken returns the hash a claim token is stored as
+func hashClaimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateClaimToken issues a token to claim a passwordless account created for
+// migrated listings. An admin hands it to the owner once they proved they own
+// the email, a new token replaces the previous one.
+func (s *UserService) CreateClaimToken(ctx context.Context, userID string) (string, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate claim token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objectID, "password": ""},
+		bson.M{"$set": bson.M{
+			"claimTokenHash":      hashClaimToken(token),
+			"claimTokenExpiresAt": time.Now().Add(claimTokenLifetime),
+		}},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create claim token: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return "", ErrNotClaimable
+	}
+
+	return token, nil
+}
+
+// ClaimAccount sets the password of the passwordless account a claim token
+// was issued for. The token can only be used once.
+func (s *UserService) ClaimAccount(ctx context.Context, token, password string) (*models.User, error) {
+	if len(password) < minPasswordLength {
+		return nil, apperrors.BadUserInput(fmt.Sprintf("password must be at least %d characters long", minPasswordLength))
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	user := &models.User{}
+	err = s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"claimTokenHash":      hashClaimToken(token),
+			"claimTokenExpiresAt": bson.M{"$gt": time.Now()},
+			"password":            "",
+		},
+		bson.M{
+			"$set":   bson.M{"password": string(hashedPassword), "updatedAt": time.Now()},
+			"$unset": bson.M{"claimTokenHash": "", "claimTokenExpiresAt": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidClaimToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim account: %v", err)
+	}
+
+	// Don't return password
+	user.Password = ""
+	return user, nil
+}
+
+// FindOrCreateSeller returns the user registered with the given email, creating
+// a passwordless seller account when there is none
+func (s *UserService) FindOrCreateSeller(ctx context.Context, name, email string, phone *string) (*models.User, error) {
+	email = strings.TrimSpace(email)
+	now := time.Now()
+
+	user := &models.User{}
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"email": email},
+		bson.M{"$setOnInsert": bson.M{
+			"name":      name,
+			"email":     email,
+			"password":  "",
+			"phone":     phone,
+			"role":      models.UserRoleSeller,
+			"createdAt": now,
+			"updatedAt": now,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find or create seller: %v", err)
 	}
 
 	// Don't return password
@@ -96,7 +323,7 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User,
 	err = s.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to find user: %v", err)
 	}
@@ -106,6 +333,63 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User,
 	return user, nil
 }
 
+// GetUsersByIDs retrieves the users with the given IDs in a single query, keyed by ID
+func (s *UserService) GetUsersByIDs(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.User, error) {
+	users := make(map[primitive.ObjectID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		user := &models.User{}
+		if err := cursor.Decode(user); err != nil {
+			return nil, fmt.Errorf("failed to decode user: %v", err)
+		}
+
+		// Don't return password
+		user.Password = ""
+		users[user.ID] = user
+	}
+
+	return users, cursor.Err()
+}
+
+// UpdateProfile updates the fields of the actor's profile that are provided
+func (s *UserService) UpdateProfile(ctx context.Context, actor *models.User, input *models.UpdateUserInput) (*models.User, error) {
+	update := bson.M{}
+	if input.Name != nil {
+		if *input.Name == "" {
+			return nil, apperrors.BadUserInput("name cannot be empty")
+		}
+		update["name"] = *input.Name
+	}
+	if input.Email != nil {
+		email := strings.TrimSpace(*input.Email)
+		if !strings.Contains(email, "@") {
+			return nil, apperrors.BadUserInput("a valid email is required")
+		}
+		// The admin email is reserved for the account created at startup
+		if s.isAdminEmail(email) && !strings.EqualFold(actor.Email, email) {
+			return nil, ErrEmailTaken
+		}
+		update["email"] = email
+	}
+	if input.Phone != nil {
+		update["phone"] = *input.Phone
+	}
+	if input.Avatar != nil {
+		update["avatar"] = *input.Avatar
+	}
+
+	return s.UpdateUser(ctx, actor.ID.Hex(), update)
+}
+
 // UpdateUser updates user profile
 func (s *UserService) UpdateUser(ctx context.Context, userID string, update bson.M) (*models.User, error) {
 	objectID, err := primitive.ObjectIDFromHex(userID)
@@ -121,6 +405,9 @@ func (s *UserService) UpdateUser(ctx context.Context, userID string, update bson
 		bson.M{"$set": update},
 	)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
 		return nil, fmt.Errorf("failed to update user: %v", err)
 	}
 
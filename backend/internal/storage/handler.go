@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the blobs of a store, the key is taken from the "key" path parameter
+func Handler(store BlobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+
+		blob, info, err := store.Get(c.Request.Context(), key)
+		if errors.Is(err, ErrBlobNotFound) || errors.Is(err, ErrInvalidKey) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to serve blob %s: %v", key, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		defer blob.Close()
+
+		// Keys are never reused, so blobs can be cached forever
+		c.Header("Content-Type", info.ContentType)
+		c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Status(http.StatusOK)
+
+		if _, err := io.Copy(c.Writer, blob); err != nil {
+			log.Printf("Failed to serve blob %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs as files below a root directory
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store writing below root, creating the directory if needed
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// path returns the file of a key
+func (s *LocalStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file first, so that readers never see a partial blob
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	return nil
+}
+
+// Get opens the file of a blob, its content type is derived from the key extension
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open blob: %v", err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat blob: %v", err)
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, nil, ErrBlobNotFound
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(target))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return file, &BlobInfo{ContentType: contentType, Size: stat.Size()}, nil
+}
+
+// Delete removes the file of a blob
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocalStore(t *testing.T) (*LocalStore, string) {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "blobs")
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	return store, root
+}
+
+// readBlob returns the content and info of a stored blob
+func readBlob(t *testing.T, store BlobStore, key string) ([]byte, *BlobInfo) {
+	t.Helper()
+	blob, info, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer blob.Close()
+
+	content, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("read %q: %v", key, err)
+	}
+	return content, info
+}
+
+// failingReader returns some bytes and then an error, like an interrupted upload
+type failingReader struct {
+	read bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("connection reset")
+	}
+	r.read = true
+	return copy(p, "partial"), nil
+}
+
+func TestLocalStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestLocalStore(t)
+
+	content := []byte("image content")
+	if err := store.Put(ctx, "cars/abc/full.jpg", bytes.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, info := readBlob(t, store, "cars/abc/full.jpg")
+	if !bytes.Equal(got, content) {
+		t.Errorf("content = %q, want %q", got, content)
+	}
+	if info.ContentType != "image/jpeg" || info.Size != int64(len(content)) {
+		t.Errorf("info = %+v, want image/jpeg of %d bytes", info, len(content))
+	}
+
+	// Putting a key again replaces the blob
+	if err := store.Put(ctx, "cars/abc/full.jpg", strings.NewReader("new"), 3, "image/jpeg"); err != nil {
+		t.Fatalf("Put again: %v", err)
+	}
+	if got, _ := readBlob(t, store, "cars/abc/full.jpg"); string(got) != "new" {
+		t.Errorf("content after replace = %q, want %q", got, "new")
+	}
+
+	if err := store.Delete(ctx, "cars/abc/full.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "cars/abc/full.jpg"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete(ctx, "cars/abc/full.jpg"); err != nil {
+		t.Errorf("Delete of a missing blob = %v, want nil", err)
+	}
+}
+
+func TestLocalStore_FailedPutKeepsPreviousBlob(t *testing.T) {
+	ctx := context.Background()
+	store, root := newTestLocalStore(t)
+
+	if err := store.Put(ctx, "cars/abc/full.jpg", strings.NewReader("complete"), 8, "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put(ctx, "cars/abc/full.jpg", &failingReader{}, 100, "image/jpeg"); err == nil {
+		t.Fatal("Put with a failing reader succeeded")
+	}
+
+	if got, _ := readBlob(t, store, "cars/abc/full.jpg"); string(got) != "complete" {
+		t.Errorf("content after failed Put = %q, want %q", got, "complete")
+	}
+
+	// The temporary file of the failed upload is removed
+	entries, err := os.ReadDir(filepath.Join(root, "cars", "abc"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("blob directory has %d entries, want only the blob", len(entries))
+	}
+}
+
+func TestLocalStore_InvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store, root := newTestLocalStore(t)
+
+	// A file next to the root that escaping keys would reach
+	outside := filepath.Join(filepath.Dir(root), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	for _, key := range []string{"../secret", "/" + outside, "cars/../../secret", ""} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	if content, err := os.ReadFile(outside); err != nil || string(content) != "secret" {
+		t.Errorf("file outside the root was changed: %q, %v", content, err)
+	}
+}
+
+func TestLocalStore_DirectoryIsNotABlob(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestLocalStore(t)
+
+	if err := store.Put(ctx, "cars/abc/full.jpg", strings.NewReader("x"), 1, "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "cars/abc"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get of a directory = %v, want ErrBlobNotFound", err)
+	}
+}
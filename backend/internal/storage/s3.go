@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures a store backed by an S3 compatible service, such as
+// AWS S3 or a local MinIO server
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// S3Store keeps blobs as objects of a bucket
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store connects to the service and creates the bucket if it does not exist
+func NewS3Store(ctx context.Context, config S3Config) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3 endpoint and bucket are required")
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check S3 bucket: %v", err)
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create S3 bucket: %v", err)
+		}
+	}
+
+	return &S3Store{client: client, bucket: config.Bucket}, nil
+}
+
+// Put uploads the blob as an object
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %v", err)
+	}
+	return nil
+}
+
+// Get opens the object of a blob
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	if err := validateKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get blob: %v", err)
+	}
+
+	// The request is only sent when the object is first used
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil, ErrBlobNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to get blob: %v", err)
+	}
+
+	return object, &BlobInfo{ContentType: stat.ContentType, Size: stat.Size}, nil
+}
+
+// Delete removes the object of a blob
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	return nil
+}
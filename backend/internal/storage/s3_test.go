@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestS3Store connects to the S3 compatible service of S3_TEST_ENDPOINT,
+// such as the minio service of docker-compose, and skips the test when unset
+func newTestS3Store(t *testing.T) *S3Store {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	accessKey, secretKey := os.Getenv("S3_TEST_ACCESS_KEY"), os.Getenv("S3_TEST_SECRET_KEY")
+	if accessKey == "" {
+		accessKey, secretKey = "minioadmin", "minioadmin"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	store, err := NewS3Store(ctx, S3Config{
+		Endpoint:  endpoint,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Bucket:    "marketplace-test",
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store
+}
+
+func TestS3Store_RoundTrip(t *testing.T) {
+	store := newTestS3Store(t)
+	ctx := context.Background()
+	key := fmt.Sprintf("test/%d/full.jpg", time.Now().UnixNano())
+
+	content := []byte("image content")
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	t.Cleanup(func() { store.Delete(context.Background(), key) })
+
+	got, info := readBlob(t, store, key)
+	if !bytes.Equal(got, content) {
+		t.Errorf("content = %q, want %q", got, content)
+	}
+	if info.ContentType != "image/jpeg" || info.Size != int64(len(content)) {
+		t.Errorf("info = %+v, want image/jpeg of %d bytes", info, len(content))
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob = %v, want nil", err)
+	}
+	if err := store.Put(ctx, "../secret", bytes.NewReader(content), int64(len(content)), "image/jpeg"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Put of an escaping key = %v, want ErrInvalidKey", err)
+	}
+}
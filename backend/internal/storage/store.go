@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under a key
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are not a clean relative path
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	ContentType string
+	Size        int64
+}
+
+// BlobStore stores binary objects such as images under slash separated keys
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error)
+	// Delete removes the blob stored under key, missing blobs are not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// validateKey rejects keys that could escape the store, such as "../x" or
+// "/x", or that name the store itself
+func validateKey(key string) error {
+	if key == "" || key == "." || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// NewBlobStoreFromEnv creates the blob store configured through environment variables:
+//
+//	STORAGE_DRIVER     local (default) or s3
+//	STORAGE_LOCAL_DIR  directory of the local store, "./uploads" by default
+//	S3_ENDPOINT        host[:port] of the S3 compatible service
+//	S3_ACCESS_KEY      access key ID
+//	S3_SECRET_KEY      secret access key
+//	S3_BUCKET          bucket name, created if missing
+//	S3_REGION          bucket region (optional)
+//	S3_USE_SSL         "false" to connect over plain HTTP, e.g. to a local stand-in
+func NewBlobStoreFromEnv(ctx context.Context) (BlobStore, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		return NewS3Store(ctx, S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		})
+	default:
+		return nil, fmt.Errorf("unsupported STORAGE_DRIVER %q", driver)
+	}
+}
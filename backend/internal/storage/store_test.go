@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{key: "cars/abc/full.jpg", valid: true},
+		{key: "image.png", valid: true},
+		{key: "..hidden", valid: false},
+		{key: "", valid: false},
+		{key: "/etc/passwd", valid: false},
+		{key: "../secret", valid: false},
+		{key: "..", valid: false},
+		{key: "cars/../../secret", valid: false},
+		{key: "cars/../other", valid: false},
+		{key: "cars//full.jpg", valid: false},
+		{key: "cars/./full.jpg", valid: false},
+		{key: "cars/", valid: false},
+		{key: ".", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := validateKey(tt.key)
+		if tt.valid && err != nil {
+			t.Errorf("validateKey(%q) = %v, want nil", tt.key, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("validateKey(%q) = %v, want ErrInvalidKey", tt.key, err)
+		}
+	}
+}
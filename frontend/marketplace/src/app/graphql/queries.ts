@@ -17,7 +17,7 @@ export const GET_CARS = gql`
         fuelType
         transmission
         status
-        images
+        images: imageUrls
         seller {
           id
           name
@@ -59,7 +59,7 @@ export const GET_CAR = gql`
       fuelType
       transmission
       status
-      images
+      images: imageUrls
       seller {
         id
         name
@@ -96,7 +96,7 @@ export const CREATE_CAR = gql`
       fuelType
       transmission
       status
-      images
+      images: imageUrls
       seller {
         id
         name
@@ -140,7 +140,7 @@ export const UPDATE_CAR = gql`
       fuelType
       transmission
       status
-      images
+      images: imageUrls
       seller {
         id
         name
@@ -178,7 +178,7 @@ export const SEARCH_CARS = gql`
         fuelType
         transmission
         status
-        images
+        images: imageUrls
         seller {
           id
           name
@@ -221,7 +221,7 @@ export const GET_MY_CARS = gql`
         fuelType
         transmission
         status
-        images
+        images: imageUrls
         seller {
           id
           name